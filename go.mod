@@ -1,13 +1,16 @@
 module otus-hiload
 
-go 1.13
+go 1.15
 
 require (
 	github.com/alexedwards/scs/mysqlstore v0.0.0-20191004123118-2c46bca4f3d3
 	github.com/alexedwards/scs/v2 v2.2.0
+	github.com/go-sql-driver/mysql v1.4.1
 	github.com/golang-migrate/migrate/v4 v4.6.2
 	github.com/gorilla/mux v1.7.3
 	github.com/gronpipmaster/go-widgets v0.0.0-20160908140342-1ad2a1cebddd
+	github.com/prometheus/client_golang v1.2.1
 	github.com/satori/go.uuid v1.2.0
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	golang.org/x/crypto v0.0.0-20190426145343-a29dc8fdc734
 )
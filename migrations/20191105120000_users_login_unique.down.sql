@@ -0,0 +1,2 @@
+-- logins stay normalized, only the constraint is dropped
+ALTER TABLE users DROP INDEX users_login_uidx;
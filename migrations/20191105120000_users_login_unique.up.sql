@@ -0,0 +1,2 @@
+UPDATE users SET login = LOWER(TRIM(login));
+ALTER TABLE users ADD UNIQUE INDEX users_login_uidx (login);
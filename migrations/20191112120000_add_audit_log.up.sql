@@ -0,0 +1,13 @@
+CREATE TABLE audit_log (
+  id bigint auto_increment not null,
+  action character varying (64) not null,
+  user_id integer null,
+  login character varying (255) not null DEFAULT "",
+  ip character varying (45) not null DEFAULT "",
+  details character varying (1000) not null DEFAULT "",
+  created_at datetime NOT NULL,
+  primary key (id)
+) engine=innodb;
+
+CREATE INDEX audit_log_login_idx ON audit_log (login, created_at);
+CREATE INDEX audit_log_created_at_idx ON audit_log (created_at);
@@ -0,0 +1,17 @@
+-- email receives the password reset links, session_version is incremented to sign out the sessions of the user
+ALTER TABLE users
+  ADD COLUMN email character varying (255) NOT NULL DEFAULT "",
+  ADD COLUMN session_version integer NOT NULL DEFAULT 0;
+
+CREATE TABLE password_resets (
+  id bigint auto_increment not null,
+  user_id integer not null,
+  token_hash char(64) not null,
+  created_at datetime NOT NULL,
+  expires_at datetime NOT NULL,
+  used_at datetime null,
+  primary key (id)
+) engine=innodb;
+
+CREATE UNIQUE INDEX password_resets_token_hash_uidx ON password_resets (token_hash);
+CREATE INDEX password_resets_user_id_idx ON password_resets (user_id);
@@ -0,0 +1,16 @@
+-- the sessions of the users: id is kept in the session data, token is the current scs token of the session
+CREATE TABLE user_sessions (
+  id char(43) not null,
+  user_id integer not null,
+  token char(43) not null,
+  ip character varying (45) not null DEFAULT "",
+  user_agent character varying (255) not null DEFAULT "",
+  created_at datetime NOT NULL,
+  last_seen_at datetime NOT NULL,
+  expires_at datetime NOT NULL,
+  revoked_at datetime null,
+  primary key (id)
+) engine=innodb;
+
+CREATE INDEX user_sessions_user_id_idx ON user_sessions (user_id);
+CREATE INDEX user_sessions_expires_at_idx ON user_sessions (expires_at);
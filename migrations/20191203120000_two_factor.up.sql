@@ -0,0 +1,19 @@
+-- the TOTP secret of the users with two-factor authentication, last_step is the time step of the last accepted code:
+-- a code is accepted once
+CREATE TABLE user_totp (
+  user_id integer not null,
+  secret character varying (64) not null,
+  last_step bigint not null DEFAULT 0,
+  created_at datetime NOT NULL,
+  primary key (user_id)
+) engine=innodb;
+
+CREATE TABLE recovery_codes (
+  id bigint auto_increment not null,
+  user_id integer not null,
+  code_hash char(64) not null,
+  used_at datetime null,
+  primary key (id)
+) engine=innodb;
+
+CREATE UNIQUE INDEX recovery_codes_user_id_code_hash_uidx ON recovery_codes (user_id, code_hash);
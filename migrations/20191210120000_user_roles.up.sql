@@ -0,0 +1,4 @@
+-- role grants access to the /admin area, blocked_at is set while the account is blocked
+ALTER TABLE users
+  ADD COLUMN role character varying (16) NOT NULL DEFAULT "user",
+  ADD COLUMN blocked_at datetime NULL;
@@ -0,0 +1,2 @@
+DROP INDEX audit_log_user_id_idx ON audit_log;
+ALTER TABLE audit_log DROP COLUMN actor_id;
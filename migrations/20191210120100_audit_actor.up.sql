@@ -0,0 +1,4 @@
+-- actor_id is the user who made the change if it is not the affected user, e.g. an administrator
+ALTER TABLE audit_log ADD COLUMN actor_id integer null;
+
+CREATE INDEX audit_log_user_id_idx ON audit_log (user_id, created_at);
@@ -0,0 +1 @@
+ALTER TABLE users DROP INDEX users_name_idx, DROP INDEX users_last_name_idx, DROP INDEX users_email_idx;
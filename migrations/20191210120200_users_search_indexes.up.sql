@@ -0,0 +1,4 @@
+-- the prefix searches of the users go through an index per column: the name search and the /admin users search
+CREATE INDEX users_name_idx ON users (name);
+CREATE INDEX users_last_name_idx ON users (last_name);
+CREATE INDEX users_email_idx ON users (email);
@@ -3,6 +3,7 @@
 # exit when any command fails
 set -e
 
-./scripts/wait-for-it.sh ${DB_URI}
+# waits for the database up to DB_CONNECT_TIMEOUT
+./bin/build migrate up
 
 exec ./bin/build
@@ -0,0 +1,176 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"runtime/debug"
+	rpprof "runtime/pprof"
+	"strings"
+	"time"
+)
+
+// Version, Commit and BuildTime are set at build time:
+// go build -ldflags "-X otus-hiload/src/admin.Version=... -X otus-hiload/src/admin.Commit=..."
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+var startTime = time.Now()
+
+// Options of the admin server
+type Options struct {
+	// Addr is host:port (loopback is expected) or unix:/path/to/socket
+	Addr string
+	// Token must be sent as "Authorization: Bearer <token>", the server does not start without it
+	Token string
+	DB    *sql.DB
+	// Config returns the current config with secrets removed
+	Config func() interface{}
+	// Metrics serves /metrics, the Prometheus scrape needs the token too
+	Metrics http.Handler
+}
+
+type buildInfo struct {
+	Version   string            `json:"version"`
+	Commit    string            `json:"commit,omitempty"`
+	BuildTime string            `json:"build_time,omitempty"`
+	GoVersion string            `json:"go_version"`
+	Module    string            `json:"module,omitempty"`
+	Deps      map[string]string `json:"deps,omitempty"`
+	StartTime time.Time         `json:"start_time"`
+}
+
+// NewServer creates the admin server serving pprof, expvar and runtime introspection.
+// It must never listen on the public port: profiles and goroutine dumps expose internals.
+func NewServer(opts Options) (*http.Server, error) {
+	if len(opts.Token) == 0 {
+		return nil, errors.New("admin token not set")
+	}
+
+	expvar.Publish("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+	if opts.DB != nil {
+		expvar.Publish("dbstats", expvar.Func(func() interface{} {
+			return opts.DB.Stats()
+		}))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/goroutines", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_ = rpprof.Lookup("goroutine").WriteTo(w, 2)
+	})
+	mux.HandleFunc("/debug/dbstats", func(w http.ResponseWriter, r *http.Request) {
+		if opts.DB == nil {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, opts.DB.Stats())
+	})
+	mux.HandleFunc("/debug/config", func(w http.ResponseWriter, r *http.Request) {
+		if opts.Config == nil {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, opts.Config())
+	})
+	if opts.Metrics != nil {
+		mux.Handle("/metrics", opts.Metrics)
+	}
+	mux.HandleFunc("/debug/buildinfo", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, getBuildInfo())
+	})
+
+	return &http.Server{
+		Addr:    opts.Addr,
+		Handler: tokenHandler(opts.Token, mux),
+		// pprof profile and trace run for the requested seconds, so there is no write timeout
+		ReadHeaderTimeout: 5 * time.Second,
+	}, nil
+}
+
+// Listen opens the listener for the admin server address, a stale unix socket file is removed first
+func Listen(addr string) (net.Listener, error) {
+	if strings.HasPrefix(addr, "unix:") {
+		path := strings.TrimPrefix(addr, "unix:")
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		// only the user of the service may connect
+		if err = os.Chmod(path, 0600); err != nil {
+			_ = l.Close()
+			return nil, err
+		}
+		return l, nil
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		log.Printf("admin server listens on non loopback address %s", addr)
+	}
+	return net.Listen("tcp", addr)
+}
+
+func tokenHandler(token string, next http.Handler) http.Handler {
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func getBuildInfo() buildInfo {
+	info := buildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+		StartTime: startTime,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.Module = bi.Main.Path
+		info.Deps = make(map[string]string, len(bi.Deps))
+		for _, dep := range bi.Deps {
+			info.Deps[dep.Path] = dep.Version
+		}
+	}
+	return info
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Printf("admin: json encode error: %s", err.Error())
+	}
+}
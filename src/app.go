@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"otus-hiload/src/config"
+	"otus-hiload/src/health"
+	"otus-hiload/src/tracing"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// app owns the server and the resources it needs, it reloads the config on SIGHUP
+// and shuts everything down in order on SIGINT/SIGTERM
+type app struct {
+	mu  sync.Mutex
+	cfg *config.Config
+
+	srv     *http.Server
+	checker *health.Checker
+	db      *sql.DB
+	// workers are background goroutines stopped after the last request is served
+	workers []func()
+	// reloaders apply the reloaded config, settings without a reloader need a restart
+	reloaders []func(cfg *config.Config) error
+}
+
+func (a *app) config() *config.Config {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.cfg
+}
+
+func (a *app) onStop(worker func()) {
+	a.workers = append(a.workers, worker)
+}
+
+func (a *app) onReload(reloader func(cfg *config.Config) error) {
+	a.reloaders = append(a.reloaders, reloader)
+}
+
+func (a *app) run() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+
+	go func() {
+		if err := a.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("listen: %s\n", err)
+		}
+	}()
+	log.Print("Server Started")
+
+	for sig := range signals {
+		if sig == syscall.SIGHUP {
+			a.reload()
+			continue
+		}
+		break
+	}
+	signal.Stop(signals)
+
+	log.Print("Server Stopped")
+	a.shutdown()
+	log.Print("Server Exited Properly")
+}
+
+func (a *app) reload() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Printf("Config reload failed, keeping the current config: %s", err.Error())
+		return
+	}
+
+	old := a.config()
+	if cfg.ServicePort != old.ServicePort || cfg.DbUri != old.DbUri || cfg.StorageDir != old.StorageDir ||
+		cfg.MigrationsDir != old.MigrationsDir || cfg.TracingExporter != old.TracingExporter {
+		log.Print("Config reload: port, database, storage, migrations and tracing exporter changes need a restart")
+	}
+
+	for _, reloader := range a.reloaders {
+		if err := reloader(cfg); err != nil {
+			log.Printf("Config reload failed: %s", err.Error())
+			return
+		}
+	}
+
+	a.mu.Lock()
+	a.cfg = cfg
+	a.mu.Unlock()
+	log.Print("Config reloaded")
+}
+
+// shutdown stops accepting requests, drains in-flight ones, stops background workers,
+// flushes traces and closes the database pool
+func (a *app) shutdown() {
+	cfg := a.config()
+
+	// load balancers see the failing readiness probe and stop routing before the listener is closed
+	a.checker.SetReady(false)
+	time.Sleep(cfg.ShutdownDrainDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := a.srv.Shutdown(ctx); err != nil {
+		log.Printf("Server Shutdown Failed, closing connections: %+v", err)
+		_ = a.srv.Close()
+	}
+
+	for _, stop := range a.workers {
+		stop()
+	}
+
+	// the deadline may be spent by the requests, flushing traces gets its own
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer flushCancel()
+	if err := tracing.Shutdown(flushCtx); err != nil {
+		log.Printf("Tracing Shutdown Failed: %+v", err)
+	}
+
+	if err := a.db.Close(); err != nil {
+		log.Printf("Database Close Failed: %+v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"otus-hiload/src/config"
+	"otus-hiload/src/fake"
+	"otus-hiload/src/repository"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// statementModes are compared by the benchmark: statements prepared once per pool, the query text with
+// arguments interpolated by the driver, and the driver default which prepares and closes a statement per call
+var statementModes = map[string]func(opts *repository.MysqlOptions){
+	"prepared": func(opts *repository.MysqlOptions) {
+		opts.PreparedStatements = true
+		opts.InterpolateParams = false
+	},
+	"interpolated": func(opts *repository.MysqlOptions) {
+		opts.PreparedStatements = false
+		opts.InterpolateParams = true
+	},
+	"unprepared": func(opts *repository.MysqlOptions) {
+		opts.PreparedStatements = false
+		opts.InterpolateParams = false
+	},
+}
+
+type benchOp struct {
+	name string
+	run  func(ctx context.Context, repo repository.IRepository, rnd *rand.Rand) error
+}
+
+type benchResult struct {
+	mode      string
+	op        string
+	ops       int
+	errors    int64
+	elapsed   time.Duration
+	latencies []time.Duration
+}
+
+// runBenchStatements implements the bench-statements subcommand, returns the process exit code.
+// It needs the users table filled, e.g. with GENERATE_FAKE_DATA.
+func runBenchStatements(args []string) int {
+	flags := flag.NewFlagSet("bench-statements", flag.ContinueOnError)
+	requests := flags.Int("n", 10000, "requests per operation and mode")
+	concurrency := flags.Int("c", 16, "concurrent workers")
+	modes := flags.String("modes", "prepared,interpolated,unprepared", "comma separated statement modes")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 || *requests <= 0 || *concurrency <= 0 {
+		return 2
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Print(err.Error())
+		return 1
+	}
+	if len(cfg.DbUri) == 0 {
+		log.Print("DB_URI env variable not set")
+		return 1
+	}
+
+	ops := []benchOp{
+		{name: "Get", run: func(ctx context.Context, repo repository.IRepository, rnd *rand.Rand) error {
+			_, err := repo.Get(ctx, 1+rnd.Int63n(1000000))
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil
+			}
+			return err
+		}},
+		{name: "FindByNamePrefix", run: func(ctx context.Context, repo repository.IRepository, rnd *rand.Rand) error {
+			name, _ := fake.GetRandomName()
+			_, err := repo.FindByNamePrefix(ctx, prefix(name, 3), 10, 0)
+			return err
+		}},
+		// fake users have no password hash, so bcrypt fails fast and the query dominates
+		{name: "FindByLoginAndPassword", run: func(ctx context.Context, repo repository.IRepository, rnd *rand.Rand) error {
+			_, err := repo.FindByLoginAndPassword(ctx, fmt.Sprintf("login%d", 1+rnd.Intn(1000000)), "password")
+			if errors.Is(err, repository.ErrInvalidCredentials) {
+				return nil
+			}
+			return err
+		}},
+	}
+
+	results := make([]*benchResult, 0)
+	for _, mode := range strings.Split(*modes, ",") {
+		apply, ok := statementModes[mode]
+		if !ok {
+			log.Printf("unknown statement mode %q", mode)
+			return 2
+		}
+		opts := mysqlOptions(cfg)
+		opts.MaxOpenConns = *concurrency
+		opts.MaxIdleConns = *concurrency
+		apply(&opts)
+
+		repo, err := repository.NewMysqlRepository(context.Background(), cfg.DbUri, opts)
+		if err != nil {
+			log.Printf("database error: %s", err.Error())
+			return 1
+		}
+		for _, op := range ops {
+			results = append(results, runBenchOp(mode, op, repo, *requests, *concurrency))
+		}
+		_ = repo.GetDB().Close()
+	}
+
+	printBenchResults(results)
+	return 0
+}
+
+func runBenchOp(mode string, op benchOp, repo repository.IRepository, requests int, concurrency int) *benchResult {
+	res := &benchResult{mode: mode, op: op.name, ops: requests, latencies: make([]time.Duration, requests)}
+	var next int64 = -1
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			for {
+				i := atomic.AddInt64(&next, 1)
+				if i >= int64(requests) {
+					return
+				}
+				opStart := time.Now()
+				if err := op.run(ctx, repo, rnd); err != nil {
+					atomic.AddInt64(&res.errors, 1)
+				}
+				res.latencies[i] = time.Since(opStart)
+			}
+		}(int64(w))
+	}
+	wg.Wait()
+	res.elapsed = time.Since(start)
+
+	sort.Slice(res.latencies, func(i, j int) bool { return res.latencies[i] < res.latencies[j] })
+	return res
+}
+
+func printBenchResults(results []*benchResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "mode\top\tops/s\tp50\tp99\terrors\t")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%.0f\t%s\t%s\t%d\t\n", r.mode, r.op,
+			float64(r.ops)/r.elapsed.Seconds(), percentile(r.latencies, 0.5), percentile(r.latencies, 0.99), r.errors)
+	}
+	_ = w.Flush()
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	return sorted[int(float64(len(sorted)-1)*p)].Round(time.Microsecond)
+}
+
+func prefix(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) > n {
+		runes = runes[:n]
+	}
+	return string(runes)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"github.com/alexedwards/scs/v2"
+	"log"
+	mathrand "math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"otus-hiload/src/config"
+	"otus-hiload/src/constants"
+	"otus-hiload/src/middleware"
+	"otus-hiload/src/repository"
+	"otus-hiload/src/sessionstore"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+type sessionBenchResult struct {
+	store     string
+	requests  int
+	errors    int64
+	elapsed   time.Duration
+	latencies []time.Duration
+	// queries is the number of the statements the database executed during the run, -1 without a database
+	queries int64
+}
+
+// runBenchSessions implements the bench-sessions subcommand, returns the process exit code.
+// Every store serves the same requests through the session middleware: authenticated users, a share of
+// the requests changes the session. The database load is the Questions counter of the server.
+func runBenchSessions(args []string) int {
+	flags := flag.NewFlagSet("bench-sessions", flag.ContinueOnError)
+	requests := flags.Int("n", 20000, "requests per store")
+	concurrency := flags.Int("c", 16, "concurrent workers")
+	users := flags.Int("users", 1000, "sessions the requests are spread over")
+	writes := flags.Float64("writes", 0.05, "share of the requests changing the session")
+	stores := flags.String("stores", "mysql,memory,redis,cookie", "comma separated session stores")
+	redisAddr := flags.String("redis", "", "redis server address, a local stand-in is started if empty")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 || *requests <= 0 || *concurrency <= 0 || *users <= 0 {
+		return 2
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Print(err.Error())
+		return 1
+	}
+	var db *sql.DB
+	if len(cfg.DbUri) > 0 {
+		db, err = repository.OpenMysql(context.Background(), cfg.DbUri, mysqlOptions(cfg))
+		if err != nil {
+			log.Printf("database error: %s", err.Error())
+			return 1
+		}
+		defer db.Close()
+	}
+
+	results := make([]*sessionBenchResult, 0)
+	for _, name := range strings.Split(*stores, ",") {
+		spec := name
+		opts := sessionstore.Options{DB: db, CleanupInterval: time.Hour}
+		switch name {
+		case "mysql":
+			if db == nil {
+				log.Print("DB_URI env variable not set, the mysql store needs it")
+				return 1
+			}
+		case "redis":
+			addr := *redisAddr
+			if len(addr) == 0 {
+				standIn, err := sessionstore.StartStandIn("127.0.0.1:0")
+				if err != nil {
+					log.Printf("redis stand-in error: %s", err.Error())
+					return 1
+				}
+				defer standIn.Close()
+				addr = standIn.Addr()
+				name = "redis (stand-in)"
+			}
+			spec = "redis://" + addr
+		case "cookie":
+			key := make([]byte, 32)
+			if _, err := rand.Read(key); err != nil {
+				log.Print(err.Error())
+				return 1
+			}
+			opts.CookieKeys = base64.StdEncoding.EncodeToString(key)
+		}
+
+		store, stop, err := sessionstore.New(spec, opts)
+		if err != nil {
+			log.Print(err.Error())
+			return 1
+		}
+		res, err := runSessionBench(name, store, db, *requests, *concurrency, *users, *writes)
+		stop()
+		if err != nil {
+			log.Printf("%s: %s", name, err.Error())
+			return 1
+		}
+		results = append(results, res)
+	}
+
+	printSessionBenchResults(results)
+	return 0
+}
+
+func runSessionBench(name string, store scs.Store, db *sql.DB, requests int, concurrency int, users int,
+	writes float64) (*sessionBenchResult, error) {
+	sessionManager := scs.New()
+	sessionManager.Store = store
+	handler := middleware.SessionHandler(sessionManager, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if r.URL.Path == constants.LoginPath {
+			_ = sessionManager.RenewToken(ctx)
+			sessionManager.Put(ctx, constants.CtxAuthenticated, true)
+			sessionManager.Put(ctx, constants.CtxUserId, int64(1))
+			return
+		}
+		if !sessionManager.GetBool(ctx, constants.CtxAuthenticated) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("write") == "1" {
+			sessionManager.Put(ctx, constants.CtxSessionSeen, time.Now().UnixNano())
+		}
+	}))
+
+	// the sessions are created before the measurement, logins are not what is compared
+	cookies := make([]string, users)
+	var cookiesMu sync.Mutex
+	for i := range cookies {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("POST", constants.LoginPath, nil))
+		cookies[i] = sessionCookie(w, sessionManager.Cookie.Name)
+		if len(cookies[i]) == 0 {
+			return nil, fmt.Errorf("no session cookie after login")
+		}
+	}
+
+	res := &sessionBenchResult{store: name, requests: requests, latencies: make([]time.Duration, requests), queries: -1}
+	var questions int64
+	if db != nil {
+		var err error
+		if questions, err = serverQuestions(db); err != nil {
+			return nil, err
+		}
+	}
+
+	var next int64 = -1
+	var wg sync.WaitGroup
+	start := time.Now()
+	for worker := 0; worker < concurrency; worker++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := mathrand.New(mathrand.NewSource(seed))
+			for {
+				i := atomic.AddInt64(&next, 1)
+				if i >= int64(requests) {
+					return
+				}
+				user := rnd.Intn(users)
+				url := constants.MePath
+				if rnd.Float64() < writes {
+					url += "?write=1"
+				}
+				req := httptest.NewRequest("GET", url, nil)
+				cookiesMu.Lock()
+				req.AddCookie(&http.Cookie{Name: sessionManager.Cookie.Name, Value: cookies[user]})
+				cookiesMu.Unlock()
+
+				requestStart := time.Now()
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				res.latencies[i] = time.Since(requestStart)
+
+				if w.Code != http.StatusOK {
+					atomic.AddInt64(&res.errors, 1)
+				}
+				// the cookie store sends a new cookie on every change of the session
+				if value := sessionCookie(w, sessionManager.Cookie.Name); len(value) > 0 {
+					cookiesMu.Lock()
+					cookies[user] = value
+					cookiesMu.Unlock()
+				}
+			}
+		}(int64(worker))
+	}
+	wg.Wait()
+	res.elapsed = time.Since(start)
+
+	if db != nil {
+		after, err := serverQuestions(db)
+		if err != nil {
+			return nil, err
+		}
+		// the counter includes the statement reading it
+		res.queries = after - questions - 1
+	}
+	sort.Slice(res.latencies, func(i, j int) bool { return res.latencies[i] < res.latencies[j] })
+	return res, nil
+}
+
+func sessionCookie(w *httptest.ResponseRecorder, name string) string {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// serverQuestions is the number of the statements executed by the server, by all its clients
+func serverQuestions(db *sql.DB) (int64, error) {
+	var name string
+	var value int64
+	err := db.QueryRow("SHOW GLOBAL STATUS LIKE 'Questions'").Scan(&name, &value)
+	return value, err
+}
+
+func printSessionBenchResults(results []*sessionBenchResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "store\treq/s\tp50\tp99\tdb queries/req\terrors\t")
+	for _, r := range results {
+		queries := "-"
+		if r.queries >= 0 {
+			queries = fmt.Sprintf("%.2f", float64(r.queries)/float64(r.requests))
+		}
+		fmt.Fprintf(w, "%s\t%.0f\t%s\t%s\t%s\t%d\t\n", r.store, float64(r.requests)/r.elapsed.Seconds(),
+			percentile(r.latencies, 0.5), percentile(r.latencies, 0.99), queries, r.errors)
+	}
+	_ = w.Flush()
+}
@@ -0,0 +1,16 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Backend stores cached values. The in-process LRU keeps values as is, a backend for an external cache
+// (memcached, redis) encodes them itself and reports network errors, which callers treat as misses.
+type Backend interface {
+	Get(ctx context.Context, key string) (value interface{}, ok bool, err error)
+	Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+	// Len is the number of cached values, -1 if the backend does not know it
+	Len() int
+}
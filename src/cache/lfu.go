@@ -0,0 +1,176 @@
+package cache
+
+import (
+	"container/heap"
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// LFU is a bounded in-process Backend which evicts the least frequently used value, the least recently
+// used one among equally used. Popular values survive bursts of one-off keys which would flush an LRU.
+// An expired value is evicted before any live one, whatever its frequency, so stale popular values
+// do not hold the space forever.
+type LFU struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	// freqs holds the entries used freq times, the most recently used first
+	freqs   map[int]*list.List
+	minFreq int
+	// expiry orders the entries by expiration, the earliest first
+	expiry lfuExpiry
+	now    func() time.Time
+}
+
+type lfuEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+	freq    int
+	// index is the position in the expiry heap
+	index int
+}
+
+// lfuExpiry is a heap.Interface of the entries by expiration
+type lfuExpiry []*lfuEntry
+
+func (h lfuExpiry) Len() int           { return len(h) }
+func (h lfuExpiry) Less(i, j int) bool { return h[i].expires.Before(h[j].expires) }
+func (h lfuExpiry) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuExpiry) Push(x interface{}) {
+	entry := x.(*lfuEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *lfuExpiry) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return entry
+}
+
+func NewLFU(size int) *LFU {
+	return &LFU{size: size, entries: make(map[string]*list.Element), freqs: make(map[int]*list.List), now: time.Now}
+}
+
+func (c *LFU) Get(ctx context.Context, key string) (interface{}, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := el.Value.(*lfuEntry)
+	if !entry.expires.After(c.now()) {
+		c.remove(el)
+		return nil, false, nil
+	}
+	c.touch(el)
+	return entry.value, true, nil
+}
+
+func (c *LFU) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := c.now().Add(ttl)
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*lfuEntry)
+		entry.value = value
+		entry.expires = expires
+		heap.Fix(&c.expiry, entry.index)
+		c.touch(el)
+		return nil
+	}
+
+	if len(c.entries) >= c.size {
+		c.evict()
+	}
+	entry := &lfuEntry{key: key, value: value, expires: expires, freq: 1}
+	c.entries[key] = c.bucket(1).PushFront(entry)
+	heap.Push(&c.expiry, entry)
+	c.minFreq = 1
+	return nil
+}
+
+func (c *LFU) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	return nil
+}
+
+func (c *LFU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+func (c *LFU) bucket(freq int) *list.List {
+	l, ok := c.freqs[freq]
+	if !ok {
+		l = list.New()
+		c.freqs[freq] = l
+	}
+	return l
+}
+
+// touch moves the entry to the next frequency
+func (c *LFU) touch(el *list.Element) {
+	entry := el.Value.(*lfuEntry)
+	c.unlink(el)
+	if entry.freq == c.minFreq && c.freqs[entry.freq] == nil {
+		c.minFreq++
+	}
+	entry.freq++
+	c.entries[entry.key] = c.bucket(entry.freq).PushFront(entry)
+}
+
+func (c *LFU) remove(el *list.Element) {
+	entry := el.Value.(*lfuEntry)
+	c.unlink(el)
+	heap.Remove(&c.expiry, entry.index)
+	delete(c.entries, entry.key)
+}
+
+func (c *LFU) evict() {
+	if len(c.expiry) > 0 && !c.expiry[0].expires.After(c.now()) {
+		c.remove(c.entries[c.expiry[0].key])
+		return
+	}
+	victims := c.freqs[c.minFreq]
+	if victims == nil {
+		// minFreq is stale after Delete or expiration, find the actual minimum
+		for freq, l := range c.freqs {
+			if victims == nil || freq < c.minFreq {
+				victims, c.minFreq = l, freq
+			}
+		}
+	}
+	if victims != nil {
+		c.remove(victims.Back())
+	}
+}
+
+// unlink removes the element from its frequency list, empty lists are dropped
+func (c *LFU) unlink(el *list.Element) {
+	freq := el.Value.(*lfuEntry).freq
+	l := c.freqs[freq]
+	l.Remove(el)
+	if l.Len() == 0 {
+		delete(c.freqs, freq)
+	}
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLFUEvictsExpiredBeforeFrequent(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	c := NewLFU(2)
+	c.now = func() time.Time { return now }
+
+	_ = c.Set(ctx, "popular", 1, time.Second)
+	for i := 0; i < 10; i++ {
+		if _, ok, _ := c.Get(ctx, "popular"); !ok {
+			t.Fatal("popular: miss before expiration")
+		}
+	}
+	_ = c.Set(ctx, "fresh", 2, time.Hour)
+
+	now = now.Add(2 * time.Second)
+	_ = c.Set(ctx, "new", 3, time.Hour)
+
+	if c.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", c.Len())
+	}
+	for _, key := range []string{"fresh", "new"} {
+		if _, ok, _ := c.Get(ctx, key); !ok {
+			t.Errorf("%s: evicted instead of the expired entry", key)
+		}
+	}
+}
+
+func TestLFUEvictsLeastFrequent(t *testing.T) {
+	ctx := context.Background()
+	c := NewLFU(2)
+
+	_ = c.Set(ctx, "a", 1, time.Hour)
+	_ = c.Set(ctx, "b", 2, time.Hour)
+	_, _, _ = c.Get(ctx, "a")
+	_ = c.Set(ctx, "c", 3, time.Hour)
+
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Error("b: kept, want evicted as the least frequent")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok, _ := c.Get(ctx, key); !ok {
+			t.Errorf("%s: evicted", key)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"otus-hiload/src/logger"
+	"otus-hiload/src/metrics"
+	"otus-hiload/src/repository"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const searchCacheName = "search"
+
+// searchRepository caches pages of FindByNamePrefix. A created user invalidates the pages of every prefix
+// of their name and last name; Update changes neither, so it does not touch the cache.
+type searchRepository struct {
+	repository.IRepository
+	backend Backend
+	ttl     time.Duration
+	loads   Group
+	// invalidations is incremented on every invalidation, a load which overlapped one is not cached
+	invalidations uint64
+
+	mu sync.Mutex
+	// keys are the cached page keys by lower cased prefix with their expiration time, used for invalidation
+	keys      map[string]map[string]time.Time
+	lastPrune time.Time
+}
+
+// NewSearchRepository caches the pages found by name prefix in the backend for ttl
+func NewSearchRepository(repo repository.IRepository, backend Backend, ttl time.Duration) repository.IRepository {
+	metrics.RegisterCacheSize(searchCacheName, backend.Len)
+	return &searchRepository{
+		IRepository: repo,
+		backend:     backend,
+		ttl:         ttl,
+		keys:        make(map[string]map[string]time.Time),
+		lastPrune:   time.Now(),
+	}
+}
+
+func searchKey(prefix string, limit int, minId int64) string {
+	return fmt.Sprintf("search:%d:%d:%s", limit, minId, prefix)
+}
+
+func (r *searchRepository) FindByNamePrefix(ctx context.Context, prefix string, limit int, minId int64) ([]*repository.User, error) {
+	key := searchKey(prefix, limit, minId)
+
+	value, ok, err := r.backend.Get(ctx, key)
+	switch {
+	case err != nil:
+		// a failed lookup is counted once, as an error, and falls through to the database
+		metrics.ObserveCache(searchCacheName, "error")
+		logger.FromContext(ctx).Error("search cache get", "error", err.Error())
+	case ok:
+		metrics.ObserveCache(searchCacheName, "hit")
+		return copyUsers(value.([]*repository.User)), nil
+	default:
+		metrics.ObserveCache(searchCacheName, "miss")
+	}
+
+	// a popular prefix expiring under load makes a single query instead of one per request
+	value, err, _ = r.loads.Do(key, func() (interface{}, error) {
+		ctx, cancel := loadContext(ctx)
+		defer cancel()
+		invalidations := atomic.LoadUint64(&r.invalidations)
+		users, err := r.IRepository.FindByNamePrefix(ctx, prefix, limit, minId)
+		if err != nil {
+			return nil, err
+		}
+		if atomic.LoadUint64(&r.invalidations) != invalidations {
+			return users, nil
+		}
+		if err := r.backend.Set(ctx, key, copyUsers(users), r.ttl); err != nil {
+			logger.FromContext(ctx).Error("search cache set", "error", err.Error())
+			return users, nil
+		}
+		r.index(strings.ToLower(prefix), key)
+		return users, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return copyUsers(value.([]*repository.User)), nil
+}
+
+func (r *searchRepository) Create(ctx context.Context, user *repository.User) error {
+	err := r.IRepository.Create(ctx, user)
+	if err == nil {
+		r.invalidate(ctx, user)
+	}
+	return err
+}
+
+func (r *searchRepository) BulkCreate(ctx context.Context, users []*repository.User) {
+	r.IRepository.BulkCreate(ctx, users)
+	for _, user := range users {
+		r.invalidate(ctx, user)
+	}
+}
+
+func (r *searchRepository) index(prefix string, key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.lastPrune) > r.ttl {
+		r.prune(now)
+	}
+
+	keys, ok := r.keys[prefix]
+	if !ok {
+		keys = make(map[string]time.Time)
+		r.keys[prefix] = keys
+	}
+	keys[key] = now.Add(r.ttl)
+}
+
+// prune drops the keys of expired pages, evicted ones are dropped from the index when they expire too
+func (r *searchRepository) prune(now time.Time) {
+	for prefix, keys := range r.keys {
+		for key, expires := range keys {
+			if !expires.After(now) {
+				delete(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			delete(r.keys, prefix)
+		}
+	}
+	r.lastPrune = now
+}
+
+// invalidate drops the cached pages the user may appear on: every prefix of the name or the last name,
+// compared case insensitively as the users collation does
+func (r *searchRepository) invalidate(ctx context.Context, user *repository.User) {
+	atomic.AddUint64(&r.invalidations, 1)
+
+	r.mu.Lock()
+	keys := make([]string, 0)
+	for _, name := range []string{user.Name, user.LastName} {
+		runes := []rune(strings.ToLower(name))
+		for i := 0; i <= len(runes); i++ {
+			prefix := string(runes[:i])
+			for key := range r.keys[prefix] {
+				keys = append(keys, key)
+			}
+			delete(r.keys, prefix)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, key := range keys {
+		r.loads.Forget(key)
+		if err := r.backend.Delete(ctx, key); err != nil {
+			logger.FromContext(ctx).Error("search cache delete", "error", err.Error())
+		}
+	}
+}
+
+func copyUsers(users []*repository.User) []*repository.User {
+	c := make([]*repository.User, len(users))
+	for i, user := range users {
+		c[i] = copyUser(user)
+	}
+	return c
+}
@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"context"
+	"otus-hiload/src/repository"
+	"testing"
+	"time"
+)
+
+// newTestSearchRepository skips NewSearchRepository, which registers the cache size metric once per process
+func newTestSearchRepository(repo repository.IRepository) *searchRepository {
+	return &searchRepository{
+		IRepository: repo,
+		backend:     NewLRU(16),
+		ttl:         time.Hour,
+		keys:        make(map[string]map[string]time.Time),
+		lastPrune:   time.Now(),
+	}
+}
+
+func names(users []*repository.User) []string {
+	n := make([]string, len(users))
+	for i, user := range users {
+		n[i] = user.Name + " " + user.LastName
+	}
+	return n
+}
+
+func TestSearchRepositoryCaches(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepository(&repository.User{ID: 1, Name: "Ivan", LastName: "Petrov"})
+	r := newTestSearchRepository(repo)
+
+	for i := 0; i < 3; i++ {
+		users, err := r.FindByNamePrefix(ctx, "Iv", 10, 1)
+		if err != nil {
+			t.Fatalf("FindByNamePrefix() error = %v", err)
+		}
+		if len(users) != 1 {
+			t.Fatalf("FindByNamePrefix() = %v, want [Ivan Petrov]", names(users))
+		}
+	}
+	// every page is cached separately
+	if _, err := r.FindByNamePrefix(ctx, "Iv", 10, 2); err != nil {
+		t.Fatalf("FindByNamePrefix() error = %v", err)
+	}
+	if repo.queries != 2 {
+		t.Errorf("queries = %d, want 2", repo.queries)
+	}
+}
+
+func TestSearchRepositoryReturnsCopies(t *testing.T) {
+	ctx := context.Background()
+	r := newTestSearchRepository(newFakeRepository(&repository.User{ID: 1, Name: "Ivan", LastName: "Petrov"}))
+
+	for i := 0; i < 3; i++ {
+		users, err := r.FindByNamePrefix(ctx, "iv", 10, 1)
+		if err != nil {
+			t.Fatalf("FindByNamePrefix() error = %v", err)
+		}
+		if len(users) != 1 || users[0].Name != "Ivan" {
+			t.Fatalf("FindByNamePrefix() #%d = %v, want [Ivan Petrov]", i, names(users))
+		}
+		users[0].Name = "Eve"
+		users[0] = nil
+	}
+}
+
+func TestSearchRepositoryInvalidates(t *testing.T) {
+	tests := []struct {
+		prefix      string
+		invalidated bool
+	}{
+		// prefixes of the name and the last name of the new user, in any case
+		{"", true},
+		{"a", true},
+		{"An", true},
+		{"ANNA", true},
+		{"iv", true},
+		{"Ivanova", true},
+		// the new user can not appear on these pages
+		{"Annabel", false},
+		{"p", false},
+		{"Petrov", false},
+	}
+	ctx := context.Background()
+	repo := newFakeRepository(&repository.User{ID: 1, Name: "Petr", LastName: "Petrov"})
+	r := newTestSearchRepository(repo)
+	for _, tt := range tests {
+		if _, err := r.FindByNamePrefix(ctx, tt.prefix, 10, 1); err != nil {
+			t.Fatalf("FindByNamePrefix(%q) error = %v", tt.prefix, err)
+		}
+	}
+
+	if err := r.Create(ctx, &repository.User{Name: "Anna", LastName: "Ivanova"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	for _, tt := range tests {
+		_, ok, _ := r.backend.Get(ctx, searchKey(tt.prefix, 10, 1))
+		if ok == tt.invalidated {
+			t.Errorf("FindByNamePrefix(%q) cached = %v, want %v", tt.prefix, ok, !tt.invalidated)
+		}
+	}
+	users, err := r.FindByNamePrefix(ctx, "Ann", 10, 1)
+	if err != nil {
+		t.Fatalf("FindByNamePrefix() error = %v", err)
+	}
+	if len(users) != 1 || users[0].Name != "Anna" {
+		t.Errorf("FindByNamePrefix(%q) = %v, want [Anna Ivanova]", "Ann", names(users))
+	}
+}
+
+func TestSearchRepositoryBulkCreateInvalidates(t *testing.T) {
+	ctx := context.Background()
+	r := newTestSearchRepository(newFakeRepository())
+	for _, prefix := range []string{"Ив", "Пет"} {
+		if _, err := r.FindByNamePrefix(ctx, prefix, 10, 1); err != nil {
+			t.Fatalf("FindByNamePrefix(%q) error = %v", prefix, err)
+		}
+	}
+
+	r.BulkCreate(ctx, []*repository.User{{Name: "Олег", LastName: "Иванов"}, {Name: "Павел", LastName: "Сидоров"}})
+
+	// the prefixes are compared in runes, a Cyrillic letter is not split in half
+	for _, prefix := range []string{"Ив", "Пет"} {
+		_, ok, _ := r.backend.Get(ctx, searchKey(prefix, 10, 1))
+		if want := prefix == "Пет"; ok != want {
+			t.Errorf("FindByNamePrefix(%q) cached = %v, want %v", prefix, ok, want)
+		}
+	}
+}
+
+func TestSearchRepositoryUpdateKeepsCache(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepository(&repository.User{ID: 1, Name: "Ivan", LastName: "Petrov"})
+	r := newTestSearchRepository(repo)
+	if _, err := r.FindByNamePrefix(ctx, "Iv", 10, 1); err != nil {
+		t.Fatalf("FindByNamePrefix() error = %v", err)
+	}
+
+	// the profile form does not change the names, so the pages stay valid
+	if err := r.Update(ctx, &repository.User{ID: 1, Name: "Ivan", LastName: "Petrov", Description: "new"}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if _, ok, _ := r.backend.Get(ctx, searchKey("Iv", 10, 1)); !ok {
+		t.Error("Update() dropped the cached page")
+	}
+}
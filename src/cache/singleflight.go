@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// loadTimeout limits a shared load, it no longer depends on the request which started it
+const loadTimeout = 10 * time.Second
+
+// detachedContext keeps the values of the parent (the logger, the trace span) but not its deadline and cancellation
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// loadContext is the context of a shared load: the caller which came first may go away or time out,
+// its load must not fail the callers waiting for it
+func loadContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(detachedContext{ctx}, loadTimeout)
+}
+
+// Group collapses concurrent loads of the same key into one: the first caller loads,
+// the others wait for its result
+type Group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+type call struct {
+	wg    sync.WaitGroup
+	value interface{}
+	err   error
+}
+
+// Do runs load once for all concurrent callers with the same key, shared is true for the waiting callers
+func (g *Group) Do(key string, load func() (interface{}, error)) (value interface{}, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.value, c.err, true
+	}
+	c := new(call)
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		if g.calls[key] == c {
+			delete(g.calls, key)
+		}
+		g.mu.Unlock()
+		c.wg.Done()
+	}()
+	c.value, c.err = load()
+	return c.value, c.err, false
+}
+
+// Forget makes the next Do for the key load again instead of joining the call in flight,
+// it is used on invalidation so nobody gets the value loaded before the change
+func (g *Group) Forget(key string) {
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+}
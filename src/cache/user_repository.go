@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"context"
+	"otus-hiload/src/logger"
+	"otus-hiload/src/metrics"
+	"otus-hiload/src/repository"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const userCacheName = "user"
+
+// userRepository is a read-through cache of user profiles returned by Get. It is local to the instance:
+// every method changing the row invalidates the profile here, other instances see the change after ttl.
+type userRepository struct {
+	repository.IRepository
+	backend Backend
+	ttl     time.Duration
+	loads   Group
+	// invalidations is incremented on every invalidation, a load which overlapped one is not cached
+	// because it may have read the row before the change
+	invalidations uint64
+}
+
+// NewUserRepository caches the profiles read by Get in the backend for ttl
+func NewUserRepository(repo repository.IRepository, backend Backend, ttl time.Duration) repository.IRepository {
+	metrics.RegisterCacheSize(userCacheName, backend.Len)
+	return &userRepository{IRepository: repo, backend: backend, ttl: ttl}
+}
+
+func userKey(id int64) string {
+	return "user:" + strconv.FormatInt(id, 10)
+}
+
+// Get returns a copy of the cached user, so callers may change it freely
+func (r *userRepository) Get(ctx context.Context, id int64) (*repository.User, error) {
+	key := userKey(id)
+
+	value, ok, err := r.backend.Get(ctx, key)
+	switch {
+	case err != nil:
+		// a failed lookup is counted once, as an error, and falls through to the database
+		metrics.ObserveCache(userCacheName, "error")
+		logger.FromContext(ctx).Error("user cache get", "error", err.Error())
+	case ok:
+		metrics.ObserveCache(userCacheName, "hit")
+		return copyUser(value.(*repository.User)), nil
+	default:
+		metrics.ObserveCache(userCacheName, "miss")
+	}
+
+	// concurrent misses of a popular profile make a single query, the caller which came first loads it
+	value, err, _ = r.loads.Do(key, func() (interface{}, error) {
+		ctx, cancel := loadContext(ctx)
+		defer cancel()
+		invalidations := atomic.LoadUint64(&r.invalidations)
+		user, err := r.IRepository.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if atomic.LoadUint64(&r.invalidations) != invalidations {
+			return user, nil
+		}
+		if err := r.backend.Set(ctx, key, copyUser(user), r.ttl); err != nil {
+			logger.FromContext(ctx).Error("user cache set", "error", err.Error())
+		}
+		return user, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return copyUser(value.(*repository.User)), nil
+}
+
+func (r *userRepository) Update(ctx context.Context, user *repository.User) error {
+	err := r.IRepository.Update(ctx, user)
+	r.invalidate(ctx, user.ID)
+	return err
+}
+
+func (r *userRepository) Create(ctx context.Context, user *repository.User) error {
+	err := r.IRepository.Create(ctx, user)
+	if err == nil {
+		r.invalidate(ctx, user.ID)
+	}
+	return err
+}
+
+// UpdatePassword changes the session version of the cached profile
+func (r *userRepository) UpdatePassword(ctx context.Context, user *repository.User) error {
+	err := r.IRepository.UpdatePassword(ctx, user)
+	r.invalidate(ctx, user.ID)
+	return err
+}
+
+func (r *userRepository) ResetPassword(ctx context.Context, tokenHash string, password string) (int64, error) {
+	userID, err := r.IRepository.ResetPassword(ctx, tokenHash, password)
+	if err == nil {
+		r.invalidate(ctx, userID)
+	}
+	return userID, err
+}
+
+func (r *userRepository) SetRole(ctx context.Context, userID int64, role string) error {
+	err := r.IRepository.SetRole(ctx, userID, role)
+	r.invalidate(ctx, userID)
+	return err
+}
+
+// SetBlocked changes the session version of the cached profile too
+func (r *userRepository) SetBlocked(ctx context.Context, userID int64, blocked bool) error {
+	err := r.IRepository.SetBlocked(ctx, userID, blocked)
+	r.invalidate(ctx, userID)
+	return err
+}
+
+func (r *userRepository) IncrementSessionVersion(ctx context.Context, userID int64) error {
+	err := r.IRepository.IncrementSessionVersion(ctx, userID)
+	r.invalidate(ctx, userID)
+	return err
+}
+
+// invalidate drops the cached profile, it is done even if the update failed as the row state is unknown then
+func (r *userRepository) invalidate(ctx context.Context, id int64) {
+	key := userKey(id)
+	atomic.AddUint64(&r.invalidations, 1)
+	r.loads.Forget(key)
+	if err := r.backend.Delete(ctx, key); err != nil {
+		logger.FromContext(ctx).Error("user cache delete", "error", err.Error())
+	}
+}
+
+func copyUser(user *repository.User) *repository.User {
+	c := *user
+	return &c
+}
@@ -0,0 +1,238 @@
+package cache
+
+import (
+	"context"
+	"otus-hiload/src/repository"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRepository keeps the users in memory and counts the queries, the methods the caches do not
+// wrap panic on the nil embedded interface
+type fakeRepository struct {
+	repository.IRepository
+	mu      sync.Mutex
+	users   map[int64]*repository.User
+	queries int
+}
+
+func newFakeRepository(users ...*repository.User) *fakeRepository {
+	repo := &fakeRepository{users: make(map[int64]*repository.User)}
+	for _, user := range users {
+		repo.users[user.ID] = copyUser(user)
+	}
+	return repo
+}
+
+func (r *fakeRepository) Get(ctx context.Context, id int64) (*repository.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queries++
+	user, ok := r.users[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return copyUser(user), nil
+}
+
+func (r *fakeRepository) FindByNamePrefix(ctx context.Context, prefix string, limit int, minId int64) ([]*repository.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queries++
+	users := make([]*repository.User, 0)
+	for id := minId; id <= int64(len(r.users)) && len(users) < limit; id++ {
+		user, ok := r.users[id]
+		if ok && (hasPrefixFold(user.Name, prefix) || hasPrefixFold(user.LastName, prefix)) {
+			users = append(users, copyUser(user))
+		}
+	}
+	return users, nil
+}
+
+func hasPrefixFold(s string, prefix string) bool {
+	return strings.HasPrefix(strings.ToLower(s), strings.ToLower(prefix))
+}
+
+func (r *fakeRepository) Create(ctx context.Context, user *repository.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user.ID = int64(len(r.users) + 1)
+	r.users[user.ID] = copyUser(user)
+	return nil
+}
+
+func (r *fakeRepository) BulkCreate(ctx context.Context, users []*repository.User) {
+	for _, user := range users {
+		_ = r.Create(ctx, user)
+	}
+}
+
+func (r *fakeRepository) Update(ctx context.Context, user *repository.User) error {
+	return r.change(user.ID, func(u *repository.User) {
+		u.Name, u.LastName, u.Description = user.Name, user.LastName, user.Description
+	})
+}
+
+func (r *fakeRepository) UpdatePassword(ctx context.Context, user *repository.User) error {
+	return r.change(user.ID, func(u *repository.User) { u.PasswordHash = user.PasswordHash; u.SessionVersion++ })
+}
+
+func (r *fakeRepository) ResetPassword(ctx context.Context, tokenHash string, password string) (int64, error) {
+	// the token of the fake is the login of the user
+	var id int64
+	r.mu.Lock()
+	for _, user := range r.users {
+		if user.Login == tokenHash {
+			id = user.ID
+		}
+	}
+	r.mu.Unlock()
+	return id, r.change(id, func(u *repository.User) { u.PasswordHash = password; u.SessionVersion++ })
+}
+
+func (r *fakeRepository) SetRole(ctx context.Context, userID int64, role string) error {
+	return r.change(userID, func(u *repository.User) { u.Role = role })
+}
+
+func (r *fakeRepository) SetBlocked(ctx context.Context, userID int64, blocked bool) error {
+	return r.change(userID, func(u *repository.User) {
+		u.BlockedAt.Valid = blocked
+		u.SessionVersion++
+	})
+}
+
+func (r *fakeRepository) IncrementSessionVersion(ctx context.Context, userID int64) error {
+	return r.change(userID, func(u *repository.User) { u.SessionVersion++ })
+}
+
+func (r *fakeRepository) change(id int64, f func(user *repository.User)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	f(user)
+	return nil
+}
+
+// newTestUserRepository skips NewUserRepository, which registers the cache size metric once per process
+func newTestUserRepository(repo repository.IRepository) *userRepository {
+	return &userRepository{IRepository: repo, backend: NewLRU(16), ttl: time.Hour}
+}
+
+func TestUserRepositoryCaches(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepository(&repository.User{ID: 1, Login: "ivan", Name: "Ivan"})
+	r := newTestUserRepository(repo)
+
+	for i := 0; i < 3; i++ {
+		user, err := r.Get(ctx, 1)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if user.Name != "Ivan" {
+			t.Fatalf("Get().Name = %q, want %q", user.Name, "Ivan")
+		}
+	}
+	if repo.queries != 1 {
+		t.Errorf("queries = %d, want 1", repo.queries)
+	}
+
+	// a missing user is not cached
+	for i := 0; i < 2; i++ {
+		if _, err := r.Get(ctx, 2); err != repository.ErrNotFound {
+			t.Fatalf("Get(2) error = %v, want %v", err, repository.ErrNotFound)
+		}
+	}
+	if repo.queries != 3 {
+		t.Errorf("queries = %d, want 3", repo.queries)
+	}
+}
+
+func TestUserRepositoryReturnsCopies(t *testing.T) {
+	ctx := context.Background()
+	r := newTestUserRepository(newFakeRepository(&repository.User{ID: 1, Login: "ivan", Name: "Ivan"}))
+
+	// the loading caller and the callers hitting the cache may all change their user
+	for i := 0; i < 3; i++ {
+		user, err := r.Get(ctx, 1)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if user.Name != "Ivan" {
+			t.Fatalf("Get() #%d Name = %q, want %q", i, user.Name, "Ivan")
+		}
+		user.Name = "Eve"
+		user.Role = "admin"
+	}
+}
+
+func TestUserRepositoryInvalidates(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(ctx context.Context, r repository.IRepository) error
+		check  func(user *repository.User) bool
+	}{
+		{"Update", func(ctx context.Context, r repository.IRepository) error {
+			return r.Update(ctx, &repository.User{ID: 1, Name: "Ivan", LastName: "Sidorov"})
+		}, func(user *repository.User) bool { return user.LastName == "Sidorov" }},
+		{"UpdatePassword", func(ctx context.Context, r repository.IRepository) error {
+			return r.UpdatePassword(ctx, &repository.User{ID: 1, PasswordHash: "new"})
+		}, func(user *repository.User) bool { return user.SessionVersion == 2 }},
+		{"ResetPassword", func(ctx context.Context, r repository.IRepository) error {
+			_, err := r.ResetPassword(ctx, "ivan", "new")
+			return err
+		}, func(user *repository.User) bool { return user.SessionVersion == 2 }},
+		{"SetRole", func(ctx context.Context, r repository.IRepository) error {
+			return r.SetRole(ctx, 1, "moderator")
+		}, func(user *repository.User) bool { return user.Role == "moderator" }},
+		{"SetBlocked", func(ctx context.Context, r repository.IRepository) error {
+			return r.SetBlocked(ctx, 1, true)
+		}, func(user *repository.User) bool { return user.BlockedAt.Valid && user.SessionVersion == 2 }},
+		{"IncrementSessionVersion", func(ctx context.Context, r repository.IRepository) error {
+			return r.IncrementSessionVersion(ctx, 1)
+		}, func(user *repository.User) bool { return user.SessionVersion == 2 }},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		repo := newFakeRepository(&repository.User{ID: 1, Login: "ivan", Name: "Ivan", Role: "user", SessionVersion: 1})
+		r := newTestUserRepository(repo)
+
+		if _, err := r.Get(ctx, 1); err != nil {
+			t.Fatalf("%s: Get() error = %v", tt.name, err)
+		}
+		if err := tt.change(ctx, r); err != nil {
+			t.Fatalf("%s: error = %v", tt.name, err)
+		}
+		if _, ok, _ := r.backend.Get(ctx, userKey(1)); ok {
+			t.Errorf("%s: the user is still cached", tt.name)
+		}
+		user, err := r.Get(ctx, 1)
+		if err != nil {
+			t.Fatalf("%s: Get() error = %v", tt.name, err)
+		}
+		if !tt.check(user) {
+			t.Errorf("%s: Get() = %+v, the change is not visible", tt.name, *user)
+		}
+		if repo.queries != 2 {
+			t.Errorf("%s: queries = %d, want 2", tt.name, repo.queries)
+		}
+	}
+}
+
+func TestUserRepositoryInvalidatesOnError(t *testing.T) {
+	ctx := context.Background()
+	r := newTestUserRepository(newFakeRepository())
+	_ = r.backend.Set(ctx, userKey(1), &repository.User{ID: 1}, time.Hour)
+
+	// the row state is unknown after a failed update, the entry is dropped anyway
+	if err := r.SetRole(ctx, 1, "admin"); err != repository.ErrNotFound {
+		t.Fatalf("SetRole() error = %v, want %v", err, repository.ErrNotFound)
+	}
+	if _, ok, _ := r.backend.Get(ctx, userKey(1)); ok {
+		t.Error("the user is still cached")
+	}
+}
@@ -6,10 +6,58 @@ const (
 	RegPath    = "/reg"
 	MePath     = "/me"
 	MeEditPath = "/me/edit"
+
+	MePasswordPath           = "/me/password"
+	MeSessionsPath           = "/me/sessions"
+	MeTwoFactorPath          = "/me/2fa"
+	LoginTwoFactorPath       = "/login/2fa"
+	PasswordResetPath        = "/password/reset"
+	PasswordResetConfirmPath = "/password/reset/confirm"
+
+	AdminUsersPath = "/admin/users"
+	AdminUserPath  = "/admin/users/{id:[0-9]+}"
+
 	UserPath   = "/user/{id:[0-9]+}"
 	SearchPath = "/search"
+	LocalePath = "/locale"
 	RootPath   = "/"
 
+	APIPrefix    = "/api/"
+	APIUsersPath = "/api/v1/users"
+	APIMePath    = "/api/v1/me"
+	APICSRFPath  = "/api/v1/csrf"
+
+	HealthzPath = "/healthz"
+	MetricsPath = "/metrics"
+	ReadyzPath  = "/readyz"
+
 	CtxUserId        = "userID"
 	CtxAuthenticated = "authenticated"
+	CtxLocale        = "locale"
+	CtxCSRFToken     = "csrfToken"
+	// CtxSessionVersion is the session version of the user when the session was authenticated
+	CtxSessionVersion = "sessionVersion"
+	// CtxSessionID identifies the session in the list of the user sessions, CtxSessionSeen is the unix time
+	// the last seen time of the session was last stored
+	CtxSessionID   = "sessionID"
+	CtxSessionSeen = "sessionSeen"
+	// CtxTwoFactorUserId is the user who passed the password check and has to enter the second factor,
+	// CtxTwoFactorStarted is the unix time of the password check
+	CtxTwoFactorUserId  = "twoFactorUserID"
+	CtxTwoFactorStarted = "twoFactorStarted"
+	// CtxUserRole is the role of the user: in the session it is the role at login, used to show the links,
+	// in the request context it is the current role checked by the role middleware
+	CtxUserRole = "userRole"
+	// CtxTOTPEnrollSecret is the TOTP secret shown for enrollment until a code confirms it
+	CtxTOTPEnrollSecret = "totpEnrollSecret"
+
+	// TOTPIssuer names the service in the authenticator apps
+	TOTPIssuer = "otus-hiload"
+
+	// CSRFField is the form field and CSRFHeader the header carrying the CSRF token
+	CSRFField  = "csrf_token"
+	CSRFHeader = "X-CSRF-Token"
+
+	// MaxUploadSize limits uploaded files, multipart bodies may exceed it by the size of the other fields
+	MaxUploadSize = 10 << 20 // 10 MB
 )
@@ -1,13 +1,16 @@
 package file_storage
 
 import (
+	"context"
 	"fmt"
 	uuid "github.com/satori/go.uuid"
 	"io"
+	"io/ioutil"
 	"log"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"otus-hiload/src/tracing"
 	"path"
 )
 
@@ -16,33 +19,58 @@ type fileStorage struct {
 }
 
 type IFileStorage interface {
-	SaveFile(file multipart.File, fileName string) (string, error)
-	DeleteFile(fileName string)
+	SaveFile(ctx context.Context, file multipart.File, fileName string) (string, error)
+	DeleteFile(ctx context.Context, fileName string)
+	// Check verifies the storage dir is writable
+	Check(ctx context.Context) error
 }
 
 func NewFileStorage(storageDir string) IFileStorage {
 	return &fileStorage{storageDir: storageDir}
 }
 
-func (s *fileStorage) DeleteFile(fileName string) {
+func (s *fileStorage) DeleteFile(ctx context.Context, fileName string) {
 	if len(fileName) == 0 {
 		return
 	}
 
+	_, span := tracing.Start(ctx, "storage.DeleteFile")
+	defer span.End()
+	span.SetAttribute("file.name", fileName)
+
 	fullPath := path.Join(s.storageDir, fileName)
 
 	var _, err = os.Stat(fullPath)
 	if err != nil {
+		span.SetError(err)
 		log.Printf("deleteFile Stat error: %s", err.Error())
 		return
 	}
 
 	err = os.Remove(fullPath)
 	if err != nil {
+		span.SetError(err)
 		log.Printf("deleteFile remove error: %s", err.Error())
 	}
 }
 
+func (s *fileStorage) Check(ctx context.Context) error {
+	f, err := ioutil.TempFile(s.storageDir, ".check-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write([]byte{0})
+	closeErr := f.Close()
+	removeErr := os.Remove(f.Name())
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	return removeErr
+}
+
 func (s *fileStorage) checkFileType(reader io.Reader) error {
 	buff := make([]byte, 512)
 	_, err := reader.Read(buff)
@@ -64,8 +92,14 @@ func (s *fileStorage) checkFileType(reader io.Reader) error {
 	return nil
 }
 
-func (s *fileStorage) SaveFile(file multipart.File, fileName string) (string, error) {
-	err := s.checkFileType(file)
+func (s *fileStorage) SaveFile(ctx context.Context, file multipart.File, fileName string) (fName string, err error) {
+	_, span := tracing.Start(ctx, "storage.SaveFile")
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
+	err = s.checkFileType(file)
 	if err != nil {
 		log.Printf("saveFile checkFileType: %s", err.Error())
 		return "", err
@@ -78,9 +112,9 @@ func (s *fileStorage) SaveFile(file multipart.File, fileName string) (string, er
 
 	ext := path.Ext(fileName)
 	uid := uuid.NewV4()
-	fName := uid.String() + ext
+	fName = uid.String() + ext
 	targetFileName := path.Join(s.storageDir, fName)
-	log.Printf("targetFileName=%s", targetFileName)
+	span.SetAttribute("file.name", fName)
 
 	f, err := os.OpenFile(targetFileName, os.O_WRONLY|os.O_CREATE, 0666)
 	if err != nil {
@@ -89,11 +123,12 @@ func (s *fileStorage) SaveFile(file multipart.File, fileName string) (string, er
 	}
 	defer f.Close()
 
-	_, err = io.Copy(f, file)
+	written, err := io.Copy(f, file)
 	if err != nil {
 		log.Printf("saveFile Copy: %s", err.Error())
 		return "", err
 	}
+	span.SetAttribute("file.size", written)
 
 	return fName, nil
 }
@@ -0,0 +1,120 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check returns nil if the dependency is usable
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker serves the liveness and readiness probes
+type Checker struct {
+	checks  []namedCheck
+	ready   int32
+	timeout time.Duration
+}
+
+type checkResult struct {
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+type readinessResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+// NewChecker creates the checker in the ready state, every check must finish within timeout
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{ready: 1, timeout: timeout}
+}
+
+// Add registers a readiness check, it must be called before serving
+func (c *Checker) Add(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// SetReady switches readiness off on shutdown so load balancers stop routing new requests before the server stops
+func (c *Checker) SetReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&c.ready, v)
+}
+
+func (c *Checker) IsReady() bool {
+	return atomic.LoadInt32(&c.ready) == 1
+}
+
+// LivenessHandler reports the process is alive and serving HTTP, it does not touch any dependency
+func (c *Checker) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+}
+
+// ReadinessHandler runs all checks concurrently and responds 503 if any of them fails or the server is shutting down
+func (c *Checker) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !c.IsReady() {
+			writeJSON(w, http.StatusServiceUnavailable, readinessResponse{Status: "shutting down", Checks: map[string]checkResult{}})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), c.timeout)
+		defer cancel()
+
+		results := make(map[string]checkResult, len(c.checks))
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for _, nc := range c.checks {
+			wg.Add(1)
+			go func(nc namedCheck) {
+				defer wg.Done()
+				started := time.Now()
+				err := nc.check(ctx)
+				result := checkResult{Status: "ok", DurationMs: float64(time.Since(started).Microseconds()) / 1000}
+				if err != nil {
+					result.Status = "fail"
+					result.Error = err.Error()
+				}
+				mu.Lock()
+				results[nc.name] = result
+				mu.Unlock()
+			}(nc)
+		}
+		wg.Wait()
+
+		response := readinessResponse{Status: "ok", Checks: results}
+		status := http.StatusOK
+		for _, result := range results {
+			if result.Status != "ok" {
+				response.Status = "fail"
+				status = http.StatusServiceUnavailable
+			}
+		}
+		writeJSON(w, status, response)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("health response encode error: %s", err.Error())
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"github.com/alexedwards/scs/v2"
+	"otus-hiload/src/file_storage"
+	"otus-hiload/src/health"
+	"otus-hiload/src/repository"
+	"time"
+)
+
+// readinessProbeToken is looked up in the session store to check it is reachable, it never exists
+const readinessProbeToken = "readiness-probe"
+
+func newHealthChecker(repo repository.IRepository, migrationsDir string, storage file_storage.IFileStorage,
+	sessionStore scs.Store) (*health.Checker, error) {
+	checker := health.NewChecker(2 * time.Second)
+
+	checker.Add("db", func(ctx context.Context) error {
+		return repo.GetDB().PingContext(ctx)
+	})
+
+	schemaCheck, err := repository.NewSchemaVersionCheck(repo.GetDB(), migrationsDir)
+	if err != nil {
+		return nil, err
+	}
+	checker.Add("migrations", schemaCheck)
+
+	checker.Add("storage", storage.Check)
+
+	checker.Add("session_store", func(ctx context.Context) error {
+		_, _, err := sessionStore.Find(readinessProbeToken)
+		return err
+	})
+
+	return checker, nil
+}
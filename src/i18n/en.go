@@ -0,0 +1,164 @@
+package i18n
+
+var en = map[string]Message{
+	"error.not_found":           {Other: "page not found"},
+	"error.conflict":            {Other: "the record already exists"},
+	"error.invalid_credentials": {Other: "invalid login or password"},
+	"error.unavailable":         {Other: "the service is temporarily unavailable, please try again later"},
+	"error.internal":            {Other: "internal server error"},
+	"error.unauthorized":        {Other: "authorization required"},
+	"error.overloaded":          {Other: "the server is overloaded, please try again later"},
+	"error.rate_limited":        {Other: "too many requests, please try again later"},
+	"error.forbidden":           {Other: "access denied"},
+	"error.title":               {Other: "Error %d"},
+
+	"csrf.invalid":    {Other: "the page has expired or the form was sent from another site, reload the page and try again"},
+	"csrf.form_parse": {Other: "the form could not be processed"},
+
+	"nav.home":           {Other: "home"},
+	"nav.me":             {Other: "my profile"},
+	"nav.edit":           {Other: "edit"},
+	"nav.password":       {Other: "password"},
+	"nav.sessions":       {Other: "sessions"},
+	"nav.two_factor":     {Other: "two-factor"},
+	"nav.admin":          {Other: "admin"},
+	"nav.search":         {Other: "search"},
+	"nav.logout":         {Other: "log out"},
+	"nav.login":          {Other: "log in"},
+	"nav.reg":            {Other: "sign up"},
+	"nav.language":       {Other: "Language"},
+	"locale.unsupported": {Other: "language [%s] is not supported"},
+
+	"form.required_fields":  {Other: "all fields are required"},
+	"form.login":            {Other: "Login"},
+	"form.password":         {Other: "Password"},
+	"form.password_confirm": {Other: "Repeat password"},
+	"form.name":             {Other: "First name"},
+	"form.last_name":        {Other: "Last name"},
+	"form.email":            {Other: "Email (to reset the password)"},
+
+	"login.throttled": {One: "too many failed login attempts, try again in %d second", Other: "too many failed login attempts, try again in %d seconds"},
+	"login.blocked":   {Other: "the account is blocked"},
+	"login.title":     {Other: "Log in"},
+	"login.heading":   {Other: "Authorization required"},
+	"login.submit":    {Other: "Log in"},
+	"login.forgot":    {Other: "Forgot your password?"},
+
+	"password.title":       {Other: "Change password"},
+	"password.old":         {Other: "Current password"},
+	"password.new":         {Other: "New password"},
+	"password.submit":      {Other: "Change password"},
+	"password.old_invalid": {Other: "wrong password"},
+
+	"sessions.title":          {Other: "Active sessions"},
+	"sessions.device":         {Other: "Device"},
+	"sessions.ip":             {Other: "IP address"},
+	"sessions.created":        {Other: "Signed in"},
+	"sessions.last_seen":      {Other: "Last seen"},
+	"sessions.current":        {Other: "this device"},
+	"sessions.revoke":         {Other: "Sign out"},
+	"sessions.revoke_other":   {Other: "Sign out everywhere else"},
+	"sessions.unknown_device": {Other: "unknown"},
+	"sessions.unknown_action": {Other: "unknown action"},
+
+	"2fa.title":          {Other: "Two-factor authentication"},
+	"2fa.enabled":        {Other: "Two-factor authentication is on."},
+	"2fa.disabled":       {Other: "Two-factor authentication is off. With it on, logging in also asks for a code from an authenticator app."},
+	"2fa.enable":         {Other: "Turn on"},
+	"2fa.disable":        {Other: "Turn off"},
+	"2fa.scan_hint":      {Other: "Scan the QR code with an authenticator app or type the key in, then enter the code the app shows."},
+	"2fa.secret":         {Other: "Key"},
+	"2fa.code":           {Other: "Code"},
+	"2fa.confirm":        {Other: "Confirm"},
+	"2fa.codes_hint":     {Other: "Recovery codes. Save them somewhere safe: each of them lets you log in once without the app, they are not shown again."},
+	"2fa.recovery_left":  {One: "%d recovery code left.", Other: "%d recovery codes left."},
+	"2fa.login_title":    {Other: "Verification code"},
+	"2fa.login_hint":     {Other: "Enter the code from the authenticator app or one of the recovery codes."},
+	"2fa.login_submit":   {Other: "Log in"},
+	"2fa.invalid_code":   {Other: "invalid code"},
+	"2fa.unknown_action": {Other: "unknown action"},
+
+	"admin.users_title":    {Other: "Users"},
+	"admin.search":         {Other: "Login, name or email"},
+	"admin.name":           {Other: "Name"},
+	"admin.email":          {Other: "Email"},
+	"admin.role":           {Other: "Role"},
+	"admin.status":         {Other: "Status"},
+	"admin.blocked":        {Other: "blocked"},
+	"admin.active":         {Other: "active"},
+	"admin.registered":     {Other: "Registered"},
+	"admin.blocked_since":  {Other: "blocked since %s UTC"},
+	"admin.on":             {Other: "on"},
+	"admin.off":            {Other: "off"},
+	"admin.block":          {Other: "Block"},
+	"admin.unblock":        {Other: "Unblock"},
+	"admin.block_reason":   {Other: "Reason"},
+	"admin.logout":         {Other: "Sign out everywhere"},
+	"admin.change_role":    {Other: "Change the role"},
+	"admin.audit":          {Other: "Audit log"},
+	"admin.audit_time":     {Other: "Time"},
+	"admin.audit_action":   {Other: "Action"},
+	"admin.audit_actor":    {Other: "By"},
+	"admin.audit_details":  {Other: "Details"},
+	"admin.forbidden":      {Other: "you can not manage this user"},
+	"admin.invalid_role":   {Other: "unknown role [%s]"},
+	"admin.unknown_action": {Other: "unknown action"},
+
+	"role.user":      {Other: "user"},
+	"role.moderator": {Other: "moderator"},
+	"role.admin":     {Other: "administrator"},
+
+	"reset.title":          {Other: "Reset password"},
+	"reset.submit":         {Other: "Send the link"},
+	"reset.sent":           {Other: "If the user with this login has an email, a link to reset the password has been sent to it."},
+	"reset.confirm_title":  {Other: "New password"},
+	"reset.confirm_submit": {Other: "Save the password"},
+	"reset.invalid_token":  {Other: "the link is invalid or expired, please request a new one"},
+	"reset.done":           {Other: "The password has been changed, log in with the new password"},
+	"reset.mail_subject":   {Other: "Password reset"},
+	"reset.mail_body":      {Other: "Hello, %s!\n\nFollow the link to set a new password:\n%s\n\nThe link is valid for %d min. If you did not ask to reset the password, just ignore this message."},
+
+	"reg.title":             {Other: "Sign up"},
+	"reg.submit":            {Other: "Sign up"},
+	"reg.password_mismatch": {Other: "passwords do not match"},
+	"reg.login_taken":       {Other: "login [%s] is already taken"},
+
+	"edit.title":         {Other: "Edit profile"},
+	"edit.legend":        {Other: "Tell about yourself"},
+	"edit.description":   {Other: "Description"},
+	"edit.photo":         {Other: "Photo"},
+	"edit.submit":        {Other: "Save"},
+	"edit.form_parse":    {Other: "the form could not be processed"},
+	"edit.upload_failed": {Other: "the file upload failed"},
+
+	"profile.heading":     {Other: "User %s %s"},
+	"profile.photo":       {Other: "Photo:"},
+	"profile.photo_alt":   {Other: "photo"},
+	"profile.description": {Other: "Description:"},
+
+	"root.title":   {Other: "Home"},
+	"root.users":   {Other: "Users:"},
+	"root.current": {Other: "[you]"},
+
+	"search.title":   {Other: "Search"},
+	"search.prefix":  {Other: "First or last name prefix"},
+	"search.submit":  {Other: "Search"},
+	"search.results": {Other: "Search results for prefix %s"},
+	"search.found":   {One: "Found %d user", Other: "Found %d users"},
+	"search.next":    {Other: "Next"},
+
+	"validation.form":              {Other: "please correct the highlighted fields"},
+	"api.invalid_json":             {Other: "the request body must be a JSON object with known fields"},
+	"validation.required":          {Other: "this field is required"},
+	"validation.min_runes":         {One: "at least %d character", Other: "at least %d characters"},
+	"validation.max_runes":         {One: "at most %d character", Other: "at most %d characters"},
+	"validation.login":             {Other: "only latin letters, digits, dots, dashes and underscores are allowed"},
+	"validation.email":             {Other: "invalid email address"},
+	"validation.name":              {Other: "only letters separated by a space, dash or apostrophe are allowed"},
+	"validation.password_length":   {One: "the password must be at least %d character long", Other: "the password must be at least %d characters long"},
+	"validation.password_too_long": {One: "the password must be at most %d byte long", Other: "the password must be at most %d bytes long"},
+	"validation.password_weak":     {Other: "the password must contain a letter and a digit"},
+	"validation.file_size":         {One: "the file must be at most %d megabyte", Other: "the file must be at most %d megabytes"},
+	"validation.file_read":         {Other: "the file could not be read"},
+	"validation.file_type":         {Other: "only JPEG, PNG and GIF images are allowed"},
+}
@@ -0,0 +1,223 @@
+package i18n
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type ctxKey struct{}
+
+// Message is a translation. Plain messages set Other only, pluralized ones set the forms the language needs:
+// One and Other for English, One, Few and Many for Russian.
+type Message struct {
+	One   string
+	Few   string
+	Many  string
+	Other string
+}
+
+type bundle struct {
+	messages map[string]Message
+	plural   func(n int, m Message) string
+	// forms are the fields plural returns, every one must be set in a pluralized message
+	forms []string
+}
+
+const DefaultLocale = "ru"
+
+var bundles = map[string]*bundle{
+	"ru": {messages: ru, plural: pluralRu, forms: []string{"One", "Few", "Many"}},
+	"en": {messages: en, plural: pluralEn, forms: []string{"One", "Other"}},
+}
+
+// form returns the plural form by its field name
+func (m Message) form(name string) string {
+	switch name {
+	case "One":
+		return m.One
+	case "Few":
+		return m.Few
+	case "Many":
+		return m.Many
+	default:
+		return m.Other
+	}
+}
+
+// isPlural reports whether the message sets any plural form, plain messages set Other only
+func (m Message) isPlural() bool {
+	return len(m.One) > 0 || len(m.Few) > 0 || len(m.Many) > 0
+}
+
+// Locales lists the supported locales, the default one first
+func Locales() []string {
+	locales := []string{DefaultLocale}
+	for locale := range bundles {
+		if locale != DefaultLocale {
+			locales = append(locales, locale)
+		}
+	}
+	sort.Strings(locales[1:])
+	return locales
+}
+
+// IsSupported reports whether there is a bundle for the locale
+func IsSupported(locale string) bool {
+	_, ok := bundles[locale]
+	return ok
+}
+
+// Check reports the messages missing in any bundle compared to the default one and the plural forms
+// missing for the plural rule of the locale, it is run on startup
+func Check() error {
+	return check(bundles)
+}
+
+func check(bundles map[string]*bundle) error {
+	// a message pluralized in any locale is formatted with N, so every locale needs all of its forms
+	plural := make(map[string]bool)
+	for _, b := range bundles {
+		for key, m := range b.messages {
+			plural[key] = plural[key] || m.isPlural()
+		}
+	}
+
+	missing := make([]string, 0)
+	for locale, b := range bundles {
+		for key := range bundles[DefaultLocale].messages {
+			if _, ok := b.messages[key]; !ok {
+				missing = append(missing, locale+":"+key)
+			}
+		}
+		for key, m := range b.messages {
+			if _, ok := bundles[DefaultLocale].messages[key]; !ok {
+				missing = append(missing, DefaultLocale+":"+key)
+			}
+			if !plural[key] {
+				continue
+			}
+			for _, form := range b.forms {
+				if len(m.form(form)) == 0 {
+					missing = append(missing, locale+":"+key+"."+form)
+				}
+			}
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("i18n: missing messages %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Localizer translates messages to one locale
+type Localizer struct {
+	locale string
+	bundle *bundle
+}
+
+// New returns the localizer of the locale, the default one if the locale is not supported
+func New(locale string) *Localizer {
+	b, ok := bundles[locale]
+	if !ok {
+		locale, b = DefaultLocale, bundles[DefaultLocale]
+	}
+	return &Localizer{locale: locale, bundle: b}
+}
+
+func (l *Localizer) Locale() string {
+	return l.locale
+}
+
+// T returns the message formatted with args as fmt.Sprintf does, an unknown key is returned as is
+func (l *Localizer) T(key string, args ...interface{}) string {
+	m, ok := l.bundle.messages[key]
+	if !ok {
+		return key
+	}
+	return format(m.Other, args)
+}
+
+// N returns the plural form of the message for n, n is the first formatting argument
+func (l *Localizer) N(key string, n int, args ...interface{}) string {
+	m, ok := l.bundle.messages[key]
+	if !ok {
+		return key
+	}
+	return format(l.bundle.plural(n, m), append([]interface{}{n}, args...))
+}
+
+func format(text string, args []interface{}) string {
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+func pluralEn(n int, m Message) string {
+	if n == 1 {
+		return m.One
+	}
+	return m.Other
+}
+
+func pluralRu(n int, m Message) string {
+	mod10, mod100 := n%10, n%100
+	switch {
+	case mod10 == 1 && mod100 != 11:
+		return m.One
+	case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+		return m.Few
+	default:
+		return m.Many
+	}
+}
+
+func WithContext(ctx context.Context, l *Localizer) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext returns the localizer of the request or the default one
+func FromContext(ctx context.Context) *Localizer {
+	if l, ok := ctx.Value(ctxKey{}).(*Localizer); ok {
+		return l
+	}
+	return New(DefaultLocale)
+}
+
+// FromAcceptLanguage picks the supported locale the client prefers most, the default one if none matches
+func FromAcceptLanguage(r *http.Request) string {
+	type preference struct {
+		locale string
+		q      float64
+	}
+	prefs := make([]preference, 0)
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if i := strings.IndexAny(tag, "-_"); i >= 0 {
+			tag = tag[:i]
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if IsSupported(tag) && q > 0 {
+			prefs = append(prefs, preference{locale: tag, q: q})
+		}
+	}
+	if len(prefs) == 0 {
+		return DefaultLocale
+	}
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
+	return prefs[0].locale
+}
@@ -0,0 +1,92 @@
+package i18n
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckCatalogs(t *testing.T) {
+	if err := Check(); err != nil {
+		t.Fatalf("Check() = %v", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		ru   map[string]Message
+		en   map[string]Message
+		want string
+	}{
+		{"complete",
+			map[string]Message{"a": {Other: "а"}, "n": {One: "%d день", Few: "%d дня", Many: "%d дней"}},
+			map[string]Message{"a": {Other: "a"}, "n": {One: "%d day", Other: "%d days"}},
+			""},
+		{"missing message",
+			map[string]Message{"a": {Other: "а"}, "b": {Other: "б"}},
+			map[string]Message{"a": {Other: "a"}, "c": {Other: "c"}},
+			"en:b, ru:c"},
+		// One and Other are enough for English, not for the three forms of the Russian rule
+		{"missing ru forms",
+			map[string]Message{"n": {One: "%d день", Many: "%d дней"}},
+			map[string]Message{"n": {One: "%d day", Other: "%d days"}},
+			"ru:n.Few"},
+		{"ru forms set as en",
+			map[string]Message{"n": {One: "%d день", Other: "%d дней"}},
+			map[string]Message{"n": {One: "%d day", Other: "%d days"}},
+			"ru:n.Few, ru:n.Many"},
+		{"missing en form",
+			map[string]Message{"n": {One: "%d день", Few: "%d дня", Many: "%d дней"}},
+			map[string]Message{"n": {Other: "%d days"}},
+			"en:n.One"},
+		// a message pluralized in one locale is formatted with N in every one
+		{"plain in one locale",
+			map[string]Message{"n": {Other: "%d дней"}},
+			map[string]Message{"n": {One: "%d day", Other: "%d days"}},
+			"ru:n.Few, ru:n.Many, ru:n.One"},
+	}
+	for _, tt := range tests {
+		err := check(map[string]*bundle{
+			"ru": {messages: tt.ru, plural: pluralRu, forms: bundles["ru"].forms},
+			"en": {messages: tt.en, plural: pluralEn, forms: bundles["en"].forms},
+		})
+		got := ""
+		if err != nil {
+			got = strings.TrimPrefix(err.Error(), "i18n: missing messages ")
+		}
+		if got != tt.want {
+			t.Errorf("%s: check() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPlural(t *testing.T) {
+	ruMessage := Message{One: "one", Few: "few", Many: "many"}
+	enMessage := Message{One: "one", Other: "other"}
+	tests := []struct {
+		n  int
+		ru string
+		en string
+	}{
+		{0, "many", "other"},
+		{1, "one", "one"},
+		{2, "few", "other"},
+		{4, "few", "other"},
+		{5, "many", "other"},
+		{11, "many", "other"},
+		{12, "many", "other"},
+		{14, "many", "other"},
+		{21, "one", "other"},
+		{22, "few", "other"},
+		{101, "one", "other"},
+		{111, "many", "other"},
+	}
+	for _, tt := range tests {
+		if got := pluralRu(tt.n, ruMessage); got != tt.ru {
+			t.Errorf("pluralRu(%d) = %q, want %q", tt.n, got, tt.ru)
+		}
+		if got := pluralEn(tt.n, enMessage); got != tt.en {
+			t.Errorf("pluralEn(%d) = %q, want %q", tt.n, got, tt.en)
+		}
+	}
+}
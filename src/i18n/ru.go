@@ -0,0 +1,164 @@
+package i18n
+
+var ru = map[string]Message{
+	"error.not_found":           {Other: "страница не найдена"},
+	"error.conflict":            {Other: "запись уже существует"},
+	"error.invalid_credentials": {Other: "комбинация логин/пароль не существует"},
+	"error.unavailable":         {Other: "сервис временно недоступен, попробуйте позже"},
+	"error.internal":            {Other: "внутренняя ошибка сервера"},
+	"error.unauthorized":        {Other: "требуется авторизация"},
+	"error.overloaded":          {Other: "сервер перегружен, повторите запрос позже"},
+	"error.rate_limited":        {Other: "слишком много запросов, повторите позже"},
+	"error.forbidden":           {Other: "доступ запрещён"},
+	"error.title":               {Other: "Ошибка %d"},
+
+	"csrf.invalid":    {Other: "страница устарела или форма отправлена с другого сайта, обновите страницу и повторите"},
+	"csrf.form_parse": {Other: "ошибка обработки формы"},
+
+	"nav.home":           {Other: "главная"},
+	"nav.me":             {Other: "текущий пользователь"},
+	"nav.edit":           {Other: "редактировать"},
+	"nav.password":       {Other: "пароль"},
+	"nav.sessions":       {Other: "сеансы"},
+	"nav.two_factor":     {Other: "2FA"},
+	"nav.admin":          {Other: "администрирование"},
+	"nav.search":         {Other: "поиск"},
+	"nav.logout":         {Other: "выход"},
+	"nav.login":          {Other: "вход"},
+	"nav.reg":            {Other: "регистрация"},
+	"nav.language":       {Other: "Язык"},
+	"locale.unsupported": {Other: "язык [%s] не поддерживается"},
+
+	"form.required_fields":  {Other: "все поля должны быть заполнены"},
+	"form.login":            {Other: "Логин"},
+	"form.password":         {Other: "Пароль"},
+	"form.password_confirm": {Other: "Пароль еще раз"},
+	"form.name":             {Other: "Имя"},
+	"form.last_name":        {Other: "Фамилия"},
+	"form.email":            {Other: "Email (для восстановления пароля)"},
+
+	"login.throttled": {One: "слишком много неудачных попыток входа, повторите через %d секунду", Few: "слишком много неудачных попыток входа, повторите через %d секунды", Many: "слишком много неудачных попыток входа, повторите через %d секунд"},
+	"login.blocked":   {Other: "учётная запись заблокирована"},
+	"login.title":     {Other: "Вход"},
+	"login.heading":   {Other: "Требуется авторизация"},
+	"login.submit":    {Other: "Войти"},
+	"login.forgot":    {Other: "Забыли пароль?"},
+
+	"password.title":       {Other: "Смена пароля"},
+	"password.old":         {Other: "Текущий пароль"},
+	"password.new":         {Other: "Новый пароль"},
+	"password.submit":      {Other: "Сменить пароль"},
+	"password.old_invalid": {Other: "неверный пароль"},
+
+	"sessions.title":          {Other: "Активные сеансы"},
+	"sessions.device":         {Other: "Устройство"},
+	"sessions.ip":             {Other: "IP-адрес"},
+	"sessions.created":        {Other: "Вход"},
+	"sessions.last_seen":      {Other: "Последняя активность"},
+	"sessions.current":        {Other: "это устройство"},
+	"sessions.revoke":         {Other: "Выйти"},
+	"sessions.revoke_other":   {Other: "Выйти на всех других устройствах"},
+	"sessions.unknown_device": {Other: "неизвестно"},
+	"sessions.unknown_action": {Other: "неизвестное действие"},
+
+	"2fa.title":          {Other: "Двухфакторная аутентификация"},
+	"2fa.enabled":        {Other: "Двухфакторная аутентификация включена."},
+	"2fa.disabled":       {Other: "Двухфакторная аутентификация выключена. Когда она включена, при входе нужен ещё код из приложения-аутентификатора."},
+	"2fa.enable":         {Other: "Включить"},
+	"2fa.disable":        {Other: "Выключить"},
+	"2fa.scan_hint":      {Other: "Отсканируйте QR-код приложением-аутентификатором или введите ключ вручную, затем введите код, который покажет приложение."},
+	"2fa.secret":         {Other: "Ключ"},
+	"2fa.code":           {Other: "Код"},
+	"2fa.confirm":        {Other: "Подтвердить"},
+	"2fa.codes_hint":     {Other: "Коды восстановления. Сохраните их в надёжном месте: каждый позволяет один раз войти без приложения, больше они показаны не будут."},
+	"2fa.recovery_left":  {One: "Остался %d код восстановления.", Few: "Осталось %d кода восстановления.", Many: "Осталось %d кодов восстановления."},
+	"2fa.login_title":    {Other: "Код подтверждения"},
+	"2fa.login_hint":     {Other: "Введите код из приложения-аутентификатора или один из кодов восстановления."},
+	"2fa.login_submit":   {Other: "Войти"},
+	"2fa.invalid_code":   {Other: "неверный код"},
+	"2fa.unknown_action": {Other: "неизвестное действие"},
+
+	"admin.users_title":    {Other: "Пользователи"},
+	"admin.search":         {Other: "Логин, имя или email"},
+	"admin.name":           {Other: "Имя"},
+	"admin.email":          {Other: "Email"},
+	"admin.role":           {Other: "Роль"},
+	"admin.status":         {Other: "Статус"},
+	"admin.blocked":        {Other: "заблокирован"},
+	"admin.active":         {Other: "активен"},
+	"admin.registered":     {Other: "Регистрация"},
+	"admin.blocked_since":  {Other: "заблокирован с %s UTC"},
+	"admin.on":             {Other: "включена"},
+	"admin.off":            {Other: "выключена"},
+	"admin.block":          {Other: "Заблокировать"},
+	"admin.unblock":        {Other: "Разблокировать"},
+	"admin.block_reason":   {Other: "Причина"},
+	"admin.logout":         {Other: "Завершить все сеансы"},
+	"admin.change_role":    {Other: "Сменить роль"},
+	"admin.audit":          {Other: "Журнал аудита"},
+	"admin.audit_time":     {Other: "Время"},
+	"admin.audit_action":   {Other: "Действие"},
+	"admin.audit_actor":    {Other: "Кем"},
+	"admin.audit_details":  {Other: "Подробности"},
+	"admin.forbidden":      {Other: "вы не можете управлять этим пользователем"},
+	"admin.invalid_role":   {Other: "неизвестная роль [%s]"},
+	"admin.unknown_action": {Other: "неизвестное действие"},
+
+	"role.user":      {Other: "пользователь"},
+	"role.moderator": {Other: "модератор"},
+	"role.admin":     {Other: "администратор"},
+
+	"reset.title":          {Other: "Восстановление пароля"},
+	"reset.submit":         {Other: "Отправить ссылку"},
+	"reset.sent":           {Other: "Если у пользователя с таким логином указан email, на него отправлена ссылка для смены пароля."},
+	"reset.confirm_title":  {Other: "Новый пароль"},
+	"reset.confirm_submit": {Other: "Сохранить пароль"},
+	"reset.invalid_token":  {Other: "ссылка недействительна или устарела, запросите новую"},
+	"reset.done":           {Other: "Пароль изменён, войдите с новым паролем"},
+	"reset.mail_subject":   {Other: "Восстановление пароля"},
+	"reset.mail_body":      {Other: "Здравствуйте, %s!\n\nДля смены пароля перейдите по ссылке:\n%s\n\nСсылка действует %d мин. Если вы не запрашивали смену пароля, просто проигнорируйте это письмо."},
+
+	"reg.title":             {Other: "Регистрация"},
+	"reg.submit":            {Other: "Зарегистрироваться"},
+	"reg.password_mismatch": {Other: "пароль должен быть равен подтверждению"},
+	"reg.login_taken":       {Other: "логин пользователя [%s] уже занят"},
+
+	"edit.title":         {Other: "Редактирование"},
+	"edit.legend":        {Other: "Заполните информацию о себе"},
+	"edit.description":   {Other: "Описание"},
+	"edit.photo":         {Other: "Фото"},
+	"edit.submit":        {Other: "Сохранить"},
+	"edit.form_parse":    {Other: "ошибка обработки формы"},
+	"edit.upload_failed": {Other: "ошибка загрузки файла"},
+
+	"profile.heading":     {Other: "Пользователь %s %s"},
+	"profile.photo":       {Other: "Фото:"},
+	"profile.photo_alt":   {Other: "фото"},
+	"profile.description": {Other: "Описание:"},
+
+	"root.title":   {Other: "Главная страница"},
+	"root.users":   {Other: "Список пользователей:"},
+	"root.current": {Other: "[текущий]"},
+
+	"search.title":   {Other: "Поиск"},
+	"search.prefix":  {Other: "Префикс имени или фамилии"},
+	"search.submit":  {Other: "Найти"},
+	"search.results": {Other: "Результаты поиска по префиксу %s"},
+	"search.found":   {One: "Найден %d пользователь", Few: "Найдено %d пользователя", Many: "Найдено %d пользователей"},
+	"search.next":    {Other: "Далее"},
+
+	"validation.form":              {Other: "проверьте заполнение полей формы"},
+	"api.invalid_json":             {Other: "тело запроса должно быть JSON объектом с известными полями"},
+	"validation.required":          {Other: "обязательное поле"},
+	"validation.min_runes":         {One: "не менее %d символа", Few: "не менее %d символов", Many: "не менее %d символов"},
+	"validation.max_runes":         {One: "не более %d символа", Few: "не более %d символов", Many: "не более %d символов"},
+	"validation.login":             {Other: "допустимы только латинские буквы, цифры, точка, дефис и подчёркивание"},
+	"validation.email":             {Other: "неверный адрес электронной почты"},
+	"validation.name":              {Other: "допустимы только буквы, разделённые пробелом, дефисом или апострофом"},
+	"validation.password_length":   {One: "пароль должен содержать не менее %d символа", Few: "пароль должен содержать не менее %d символов", Many: "пароль должен содержать не менее %d символов"},
+	"validation.password_too_long": {One: "пароль должен быть не длиннее %d байта", Few: "пароль должен быть не длиннее %d байт", Many: "пароль должен быть не длиннее %d байт"},
+	"validation.password_weak":     {Other: "пароль должен содержать букву и цифру"},
+	"validation.file_size":         {One: "файл должен быть не больше %d мегабайта", Few: "файл должен быть не больше %d мегабайт", Many: "файл должен быть не больше %d мегабайт"},
+	"validation.file_read":         {Other: "не удалось прочитать файл"},
+	"validation.file_type":         {Other: "допустимы только изображения JPEG, PNG и GIF"},
+}
@@ -0,0 +1,126 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ctxKey struct{}
+
+// Logger writes one JSON object per line: time, level, msg and the fields attached with With
+type Logger struct {
+	out    *output
+	fields []interface{}
+}
+
+type output struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+var defaultLogger = New(os.Stderr)
+
+func New(w io.Writer) *Logger {
+	return &Logger{out: &output{w: w}}
+}
+
+// Default is the process wide logger used when the context carries none
+func Default() *Logger {
+	return defaultLogger
+}
+
+// FromContext returns the request logger stored by WithContext or the default one
+func FromContext(ctx context.Context) *Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(ctxKey{}).(*Logger); ok {
+			return l
+		}
+	}
+	return defaultLogger
+}
+
+func WithContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// With returns a logger which adds the key/value pairs to every line
+func (l *Logger) With(keyValues ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keyValues))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyValues...)
+	return &Logger{out: l.out, fields: fields}
+}
+
+func (l *Logger) Info(msg string, keyValues ...interface{}) {
+	l.write("info", msg, keyValues)
+}
+
+func (l *Logger) Error(msg string, keyValues ...interface{}) {
+	l.write("error", msg, keyValues)
+}
+
+// Writer adapts the logger to io.Writer, every written line becomes an info message.
+// It is used to route the standard log package through the logger.
+func (l *Logger) Writer() io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		l.Info(strings.TrimRight(string(p), "\n"))
+		return len(p), nil
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func (l *Logger) write(level string, msg string, keyValues []interface{}) {
+	buf := new(bytes.Buffer)
+	buf.WriteString(`{"time":`)
+	writeValue(buf, time.Now().UTC().Format(time.RFC3339Nano))
+	buf.WriteString(`,"level":`)
+	writeValue(buf, level)
+	buf.WriteString(`,"msg":`)
+	writeValue(buf, msg)
+	writeFields(buf, l.fields)
+	writeFields(buf, keyValues)
+	buf.WriteString("}\n")
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	_, _ = l.out.w.Write(buf.Bytes())
+}
+
+func writeFields(buf *bytes.Buffer, keyValues []interface{}) {
+	for i := 0; i < len(keyValues); i += 2 {
+		buf.WriteByte(',')
+		writeValue(buf, fmt.Sprint(keyValues[i]))
+		buf.WriteByte(':')
+		if i+1 < len(keyValues) {
+			writeValue(buf, keyValues[i+1])
+		} else {
+			buf.WriteString("null")
+		}
+	}
+}
+
+func writeValue(buf *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case fmt.Stringer:
+		value = v.String()
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(b)
+}
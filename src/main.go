@@ -2,51 +2,103 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"github.com/alexedwards/scs/mysqlstore"
 	"github.com/alexedwards/scs/v2"
 	"github.com/gorilla/mux"
+	"html/template"
 	"log"
 	"net/http"
 	"os"
-	"os/signal"
+	"otus-hiload/src/admin"
+	"otus-hiload/src/cache"
+	"otus-hiload/src/config"
 	"otus-hiload/src/constants"
 	"otus-hiload/src/fake"
 	"otus-hiload/src/file_storage"
+	"otus-hiload/src/i18n"
+	"otus-hiload/src/logger"
+	"otus-hiload/src/metrics"
 	"otus-hiload/src/middleware"
+	"otus-hiload/src/notify"
+	"otus-hiload/src/ratelimit"
 	"otus-hiload/src/repository"
+	"otus-hiload/src/roles"
 	"otus-hiload/src/service"
-	"syscall"
+	"otus-hiload/src/sessions"
+	"otus-hiload/src/sessionstore"
+	"otus-hiload/src/throttle"
+	"otus-hiload/src/tracing"
+	"otus-hiload/src/view"
 	"time"
 )
 
 func main() {
-	port := os.Getenv("SERVICE_PORT")
-	if len(port) == 0 {
+	log.SetFlags(0)
+	log.SetOutput(logger.Default().Writer())
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bench-statements" {
+		os.Exit(runBenchStatements(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bench-sessions" {
+		os.Exit(runBenchSessions(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "set-role" {
+		os.Exit(runSetRole(os.Args[2:]))
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+	if len(cfg.ServicePort) == 0 {
 		log.Fatalf("SERVICE_PORT env variable not set")
 	}
-	dsn := os.Getenv("DB_URI")
-	if len(dsn) == 0 {
+	if len(cfg.DbUri) == 0 {
 		log.Fatalf("DB_URI env variable not set")
 	}
-	storageDir := os.Getenv("STORAGE_DIR")
-	if len(dsn) == 0 {
+	if len(cfg.StorageDir) == 0 {
 		log.Fatalf("STORAGE_DIR env variable not set")
 	}
-	generateStr := os.Getenv("GENERATE_FAKE_DATA")
-	generate := false
-	if len(generateStr) > 0 {
-		generate = true
+
+	if cfg.SessionCookieSameSite == "none" && !cfg.SessionCookieSecure {
+		log.Fatalf("SESSION_COOKIE_SAMESITE=none requires SESSION_COOKIE_SECURE")
+	}
+
+	if len(cfg.TracingExporter) > 0 {
+		exporter, err := tracing.NewExporter(cfg.TracingExporter)
+		if err != nil {
+			log.Fatalf("tracing exporter error: %s", err.Error())
+		}
+		tracing.SetExporter(exporter, cfg.TracingSampleRatio)
 	}
 
-	err := repository.Migrate(dsn, "migrations")
+	mysqlRepo, err := repository.NewMysqlRepository(context.Background(), cfg.DbUri, mysqlOptions(cfg))
 	if err != nil {
-		log.Fatalf("migration error: %s", err.Error())
+		log.Fatalf("database error: %s", err.Error())
+	}
+	repo := metrics.InstrumentRepository(mysqlRepo)
+	if cfg.UserCacheSize > 0 {
+		repo = cache.NewUserRepository(repo, cache.NewLRU(cfg.UserCacheSize), cfg.UserCacheTTL)
+	}
+	if cfg.SearchCacheSize > 0 {
+		repo = cache.NewSearchRepository(repo, cache.NewLFU(cfg.SearchCacheSize), cfg.SearchCacheTTL)
 	}
 
-	repo := repository.NewMysqlRepository(dsn)
+	// schema is migrated by the migrate subcommand, auto migration on start is opt-in
+	if cfg.MigrateOnStart {
+		err := repository.Migrate(cfg.DbUri, cfg.MigrationsDir)
+		if err != nil {
+			log.Fatalf("migration error: %s", err.Error())
+		}
+	}
 
-	if generate {
+	metrics.RegisterDBStats(repo.GetDB())
+
+	if cfg.GenerateFakeData {
 		log.Println("start generation")
 		count := 1000000
 		users := make([]*repository.User, count, count)
@@ -61,61 +113,283 @@ func main() {
 			users[i-1] = user
 		}
 		log.Println("generation finished, start saving")
-		repo.BulkCreate(users)
+		repo.BulkCreate(context.Background(), users)
 		log.Println("saving finished")
 	}
 
 	sessionManager := scs.New()
-	sessionManager.Store = mysqlstore.New(repo.GetDB())
+	sessionManager.Cookie.HttpOnly = true
+	sessionManager.Cookie.Secure = cfg.SessionCookieSecure
+	sessionManager.Cookie.SameSite = sameSiteMode(cfg.SessionCookieSameSite)
+	sessionStore, stopSessionStore, err := sessionstore.New(cfg.SessionStore, sessionstore.Options{
+		DB:              repo.GetDB(),
+		CookieKeys:      cfg.SessionCookieKeys,
+		CleanupInterval: 5 * time.Minute,
+	})
+	if err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+	if cfg.SessionStore == "cookie" {
+		// nothing leaves the process, and the session handler needs the cookie encoder of the store itself
+		sessionManager.Store = sessionStore
+	} else {
+		sessionManager.Store = metrics.InstrumentSessionStore(sessionStore)
+	}
+	sessionRegistry := sessions.NewRegistry(sessionManager, repo, cfg.SessionTouchInterval)
 
-	storage := file_storage.NewFileStorage(storageDir)
-	userService := service.NewUserService(repo, sessionManager, storage)
+	storage := metrics.InstrumentFileStorage(file_storage.NewFileStorage(cfg.StorageDir))
+	if err := i18n.Check(); err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+	templates, err := view.Load(cfg.TemplatesDir, i18n.Locales(), templateFuncs)
+	if err != nil {
+		log.Fatalf("templates error: %s", err.Error())
+	}
+	loginGuard := throttle.NewLoginGuard(throttle.Policy{
+		BaseDelay:   cfg.LoginBackoff,
+		MaxDelay:    cfg.LoginBackoffMax,
+		MaxFailures: cfg.LoginMaxFailures,
+		Lockout:     cfg.LoginLockout,
+		Window:      cfg.LoginFailureWindow,
+	}, throttle.Policy{
+		// no backoff per ip: clients behind a NAT share it, only the lockout applies
+		MaxFailures: cfg.LoginIPMaxFailures,
+		Lockout:     cfg.LoginLockout,
+		Window:      cfg.LoginFailureWindow,
+	})
+	notifier, err := notify.New(cfg.Notifier, cfg.MailFrom)
+	if err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+	userService := service.NewUserService(repo, sessionManager, storage, templates, loginGuard, service.PasswordResetOptions{
+		Notifier: notifier,
+		TTL:      cfg.PasswordResetTTL,
+		BaseURL:  cfg.PublicURL,
+	}, sessionRegistry)
+
+	rateLimits := middleware.RateLimits{
+		IP:   newRateLimiter(cfg.RateLimitIP, cfg.RateLimitIPBurst),
+		User: newRateLimiter(cfg.RateLimitUser, cfg.RateLimitUserBurst),
+		Routes: map[string]*ratelimit.Limiter{
+			constants.SearchPath:        newRateLimiter(cfg.RateLimitSearch, cfg.RateLimitSearchBurst),
+			constants.PasswordResetPath: newRateLimiter(cfg.RateLimitPasswordReset, cfg.RateLimitPasswordResetBurst),
+		},
+	}
+	var loadShedder *ratelimit.AdaptiveLimiter
+	if cfg.LoadShedMaxConcurrency > 0 {
+		loadShedder = ratelimit.NewAdaptiveLimiter(ratelimit.AdaptiveOptions{
+			Min:        cfg.LoadShedMinConcurrency,
+			Max:        cfg.LoadShedMaxConcurrency,
+			TargetWait: cfg.LoadShedTargetWait,
+			Interval:   time.Second,
+		})
+		metrics.RegisterConcurrencyLimit(loadShedder.Limit)
+	}
 
 	r := mux.NewRouter()
+	r.Use(middleware.RequestIDHandler)
+	r.Use(middleware.AccessLogHandler)
+	r.Use(tracing.HTTPHandler)
+	r.Use(metrics.HTTPHandler)
 	r.Use(middleware.RecoverHandler)
-	r.Use(sessionManager.LoadAndSave)
+	if loadShedder != nil {
+		r.Use(middleware.LoadShedHandler(loadShedder))
+	}
+	// the limits go before the middlewares which query the database: the ip one does not need the session,
+	// the user one needs only the session
+	r.Use(middleware.IPRateLimitHandler(rateLimits))
+	r.Use(middleware.SessionHandler(sessionManager, sessionRegistry.TokenHandler))
+	r.Use(middleware.LocaleHandler(sessionManager))
+	r.Use(middleware.RateLimitHandler(sessionManager, rateLimits))
+	r.Use(middleware.SessionVersionHandler(sessionManager, func(ctx context.Context, userID int64) (int, error) {
+		user, err := repo.Get(ctx, userID)
+		if errors.Is(err, repository.ErrNotFound) {
+			// no version matches, the session of a deleted user is signed out
+			return -1, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		return user.SessionVersion, nil
+	}))
+	r.Use(sessionRegistry.Handler)
+	r.Use(middleware.CSRFHandler(sessionManager))
 
 	r.Handle(constants.RegPath, middleware.NotAuthHandler(http.HandlerFunc(userService.RegHandler), sessionManager)).Methods("GET", "POST")
 	r.Handle(constants.LoginPath, middleware.NotAuthHandler(http.HandlerFunc(userService.LoginHandler), sessionManager)).Methods("GET", "POST")
+	r.Handle(constants.LoginTwoFactorPath, middleware.NotAuthHandler(http.HandlerFunc(userService.TwoFactorLoginHandler), sessionManager)).Methods("GET", "POST")
 
-	r.Handle(constants.LogoutPath, middleware.AuthHandler(http.HandlerFunc(userService.LogoutHandler), sessionManager)).Methods("GET")
+	r.Handle(constants.LogoutPath, middleware.AuthHandler(http.HandlerFunc(userService.LogoutHandler), sessionManager)).Methods("POST")
 	r.Handle(constants.MePath, middleware.AuthHandler(http.HandlerFunc(userService.MeHandler), sessionManager)).Methods("GET")
+	r.Handle(constants.MePasswordPath, middleware.AuthHandler(http.HandlerFunc(userService.PasswordHandler), sessionManager)).Methods("GET", "POST")
+	r.Handle(constants.MeSessionsPath, middleware.AuthHandler(http.HandlerFunc(userService.SessionsHandler), sessionManager)).Methods("GET", "POST")
+	r.Handle(constants.MeTwoFactorPath, middleware.AuthHandler(http.HandlerFunc(userService.TwoFactorHandler), sessionManager)).Methods("GET", "POST")
+	r.Handle(constants.PasswordResetPath, middleware.NotAuthHandler(http.HandlerFunc(userService.PasswordResetHandler), sessionManager)).Methods("GET", "POST")
+	r.Handle(constants.PasswordResetConfirmPath, middleware.NotAuthHandler(http.HandlerFunc(userService.PasswordResetConfirmHandler), sessionManager)).Methods("GET", "POST")
 	r.Handle(constants.MeEditPath, middleware.AuthHandler(http.HandlerFunc(userService.EditHandler), sessionManager)).Methods("GET", "POST")
 	r.Handle(constants.RootPath, middleware.AuthHandler(http.HandlerFunc(userService.RootHandler), sessionManager)).Methods("GET")
 	r.Handle(constants.UserPath, middleware.AuthHandler(http.HandlerFunc(userService.UserHandler), sessionManager)).Methods("GET")
 	r.Handle(constants.SearchPath, http.HandlerFunc(userService.SearchHandler)).Methods("GET")
+	r.Handle(constants.APIUsersPath, http.HandlerFunc(userService.APIRegisterHandler)).Methods("POST")
+	r.Handle(constants.APIMePath, middleware.AuthHandler(http.HandlerFunc(userService.APIUpdateMeHandler), sessionManager)).Methods("PUT")
+	r.Handle(constants.APICSRFPath, http.HandlerFunc(userService.APICSRFHandler)).Methods("GET")
+	userRole := func(ctx context.Context, userID int64) (string, error) {
+		user, err := repo.Get(ctx, userID)
+		if errors.Is(err, repository.ErrNotFound) {
+			// the session version middleware signs the session out, until then it has no rights
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return user.Role, nil
+	}
+	r.Handle(constants.AdminUsersPath, middleware.RoleHandler(http.HandlerFunc(userService.AdminUsersHandler), sessionManager, roles.Moderator, userRole)).Methods("GET")
+	r.Handle(constants.AdminUserPath, middleware.RoleHandler(http.HandlerFunc(userService.AdminUserHandler), sessionManager, roles.Moderator, userRole)).Methods("GET", "POST")
+	r.Handle(constants.LocalePath, http.HandlerFunc(userService.LocaleHandler)).Methods("POST")
 
-	r.PathPrefix("/img/").Handler(http.StripPrefix("/img/", http.FileServer(http.Dir(storageDir))))
+	r.PathPrefix("/img/").Handler(http.StripPrefix("/img/", http.FileServer(http.Dir(cfg.StorageDir))))
 
-	srv := &http.Server{
-		Addr:    ":" + port,
-		Handler: r,
+	checker, err := newHealthChecker(repo, cfg.MigrationsDir, storage, sessionManager.Store)
+	if err != nil {
+		log.Fatalf("health checker error: %s", err.Error())
 	}
-	listen(srv, 5)
-}
 
-func listen(srv *http.Server, timeout time.Duration) {
-	done := make(chan os.Signal, 1)
-	signal.Notify(done, os.Interrupt, syscall.SIGTERM)
+	// probes bypass the router middlewares: no session, access log or metrics for them
+	root := http.NewServeMux()
+	root.Handle(constants.HealthzPath, checker.LivenessHandler())
+	root.Handle(constants.ReadyzPath, checker.ReadinessHandler())
+	// the metrics are served by the admin server if there is one, otherwise here next to the probes
+	if len(cfg.AdminAddr) == 0 {
+		root.Handle(constants.MetricsPath, metrics.Handler())
+	}
+	root.Handle("/", r)
 
+	a := &app{
+		cfg: cfg,
+		srv: &http.Server{
+			Addr:    ":" + cfg.ServicePort,
+			Handler: root,
+		},
+		checker: checker,
+		db:      repo.GetDB(),
+	}
+	a.onStop(stopSessionStore)
+	// templates are reloaded first, so invalid ones abort the reload before anything is applied
+	a.onReload(func(cfg *config.Config) error {
+		return templates.Reload()
+	})
+	stopCleanup := make(chan struct{})
+	go loginGuard.RunCleanup(time.Minute, stopCleanup)
+	go sessionRegistry.RunCleanup(time.Hour, stopCleanup)
+	rateLimits.RunCleanup(time.Minute, stopCleanup)
+	if loadShedder != nil {
+		go loadShedder.Run(a.db, stopCleanup)
+	}
+	a.onStop(func() {
+		close(stopCleanup)
+	})
+	// the reset links are queued by the requests, the worker stops after the server and sends the queued ones
+	stopResets := make(chan struct{})
+	resetsDone := make(chan struct{})
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("listen: %s\n", err)
-		}
+		userService.RunPasswordResets(stopResets)
+		close(resetsDone)
 	}()
-	log.Print("Server Started")
+	a.onStop(func() {
+		close(stopResets)
+		<-resetsDone
+	})
+	if cfg.TemplatesDev {
+		stopWatch := make(chan struct{})
+		go templates.Watch(time.Second, stopWatch)
+		a.onStop(func() {
+			close(stopWatch)
+		})
+	}
+	if len(cfg.AdminAddr) > 0 {
+		startAdminServer(a)
+	}
+	a.onReload(func(cfg *config.Config) error {
+		tracing.SetSampleRatio(cfg.TracingSampleRatio)
+		return nil
+	})
+	a.run()
+}
 
-	<-done
-	log.Print("Server Stopped")
+// templateFuncs are bound to the locale the templates are parsed for
+func templateFuncs(locale string) template.FuncMap {
+	l := i18n.New(locale)
+	return template.FuncMap{
+		"T": l.T,
+		"N": l.N,
+	}
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer func() {
-		// extra handling here
-		cancel()
-	}()
+// newRateLimiter is nil for the zero rate, nil limiters are skipped
+func newRateLimiter(perSecond float64, burst int) *ratelimit.Limiter {
+	rate := ratelimit.Rate{PerSecond: perSecond, Burst: burst}
+	if !rate.Enabled() {
+		return nil
+	}
+	return ratelimit.NewLimiter(rate)
+}
+
+// sameSiteMode maps the validated SESSION_COOKIE_SAMESITE value to the cookie attribute
+func sameSiteMode(mode string) http.SameSite {
+	switch mode {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
 
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server Shutdown Failed: %+v", err)
+func mysqlOptions(cfg *config.Config) repository.MysqlOptions {
+	return repository.MysqlOptions{
+		MaxOpenConns:       cfg.DbMaxOpenConns,
+		MaxIdleConns:       cfg.DbMaxIdleConns,
+		ConnMaxIdleTime:    cfg.DbConnMaxIdleTime,
+		ConnMaxLifetime:    cfg.DbConnMaxLifetime,
+		DialTimeout:        cfg.DbDialTimeout,
+		ReadTimeout:        cfg.DbReadTimeout,
+		WriteTimeout:       cfg.DbWriteTimeout,
+		InterpolateParams:  cfg.DbInterpolateParams,
+		PreparedStatements: cfg.DbPreparedStmts,
+		ConnectTimeout:     cfg.DbConnectTimeout,
+	}
+}
+
+// startAdminServer serves pprof and runtime introspection on a separate private listener
+func startAdminServer(a *app) {
+	cfg := a.config()
+	adminSrv, err := admin.NewServer(admin.Options{
+		Addr:  cfg.AdminAddr,
+		Token: cfg.AdminToken,
+		DB:    a.db,
+		Config: func() interface{} {
+			return a.config().Redacted()
+		},
+		Metrics: metrics.Handler(),
+	})
+	if err != nil {
+		log.Fatalf("admin server error: %s", err.Error())
 	}
-	log.Print("Server Exited Properly")
+	listener, err := admin.Listen(cfg.AdminAddr)
+	if err != nil {
+		log.Fatalf("admin server listen error: %s", err.Error())
+	}
+
+	go func() {
+		if err := adminSrv.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("admin server error: %s", err.Error())
+		}
+	}()
+	log.Printf("Admin Server Started on %s", cfg.AdminAddr)
+
+	a.onStop(func() {
+		_ = adminSrv.Close()
+	})
 }
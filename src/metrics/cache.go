@@ -0,0 +1,21 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// ObserveCache counts a lookup of the named cache, result is hit, miss or error
+func ObserveCache(cache string, result string) {
+	cacheRequests.WithLabelValues(cache, result).Inc()
+}
+
+// RegisterCacheSize exposes the number of values in the named cache
+func RegisterCacheSize(cache string, size func() int) {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Subsystem:   "cache",
+		Name:        "entries",
+		Help:        "Number of values in the cache.",
+		ConstLabels: prometheus.Labels{"cache": cache},
+	}, func() float64 {
+		return float64(size())
+	}))
+}
@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"github.com/gorilla/mux"
+	"net/http"
+	"otus-hiload/src/statuswriter"
+	"strconv"
+	"time"
+)
+
+// HTTPHandler counts requests and observes their latency labeled by the mux route template (e.g. /user/{id:[0-9]+})
+// instead of the raw path, so the number of series stays bounded
+func HTTPHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		httpInFlight.Inc()
+		defer httpInFlight.Dec()
+
+		sw := statuswriter.Wrap(w)
+		h.ServeHTTP(sw, r)
+
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if tpl, err := current.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(sw.Status())).Inc()
+		httpDuration.WithLabelValues(route, r.Method).Observe(since(started))
+	})
+}
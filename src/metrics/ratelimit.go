@@ -0,0 +1,20 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// ObserveRejected counts a request rejected by the limits, reason is rate_limit or load_shed
+func ObserveRejected(route string, reason string) {
+	httpRejected.WithLabelValues(route, reason).Inc()
+}
+
+// RegisterConcurrencyLimit exposes the current limit of the load shedding limiter
+func RegisterConcurrencyLimit(limit func() int) {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "concurrency_limit",
+		Help:      "Requests served concurrently before the load is shed.",
+	}, func() float64 {
+		return float64(limit())
+	}))
+}
@@ -0,0 +1,236 @@
+package metrics
+
+import (
+	"context"
+	"otus-hiload/src/repository"
+	"time"
+)
+
+type instrumentedRepository struct {
+	repository.IRepository
+}
+
+// InstrumentRepository observes latency of every repository method
+func InstrumentRepository(repo repository.IRepository) repository.IRepository {
+	return &instrumentedRepository{IRepository: repo}
+}
+
+func observeQuery(method string, started time.Time, err error) {
+	queryDuration.WithLabelValues(method, result(err)).Observe(since(started))
+}
+
+func (r *instrumentedRepository) GetAll(ctx context.Context) ([]*repository.User, error) {
+	started := time.Now()
+	users, err := r.IRepository.GetAll(ctx)
+	observeQuery("GetAll", started, err)
+	return users, err
+}
+
+func (r *instrumentedRepository) Get(ctx context.Context, id int64) (*repository.User, error) {
+	started := time.Now()
+	user, err := r.IRepository.Get(ctx, id)
+	observeQuery("Get", started, err)
+	return user, err
+}
+
+func (r *instrumentedRepository) Create(ctx context.Context, user *repository.User) error {
+	started := time.Now()
+	err := r.IRepository.Create(ctx, user)
+	observeQuery("Create", started, err)
+	return err
+}
+
+func (r *instrumentedRepository) Update(ctx context.Context, user *repository.User) error {
+	started := time.Now()
+	err := r.IRepository.Update(ctx, user)
+	observeQuery("Update", started, err)
+	return err
+}
+
+func (r *instrumentedRepository) IsLoginExist(ctx context.Context, login string) (bool, error) {
+	started := time.Now()
+	exist, err := r.IRepository.IsLoginExist(ctx, login)
+	observeQuery("IsLoginExist", started, err)
+	return exist, err
+}
+
+func (r *instrumentedRepository) FindByLoginAndPassword(ctx context.Context, login string, password string) (*repository.User, error) {
+	started := time.Now()
+	user, err := r.IRepository.FindByLoginAndPassword(ctx, login, password)
+	observeQuery("FindByLoginAndPassword", started, err)
+	return user, err
+}
+
+func (r *instrumentedRepository) FindByNamePrefix(ctx context.Context, prefix string, limit int, minId int64) ([]*repository.User, error) {
+	started := time.Now()
+	users, err := r.IRepository.FindByNamePrefix(ctx, prefix, limit, minId)
+	observeQuery("FindByNamePrefix", started, err)
+	return users, err
+}
+
+func (r *instrumentedRepository) GetByLogin(ctx context.Context, login string) (*repository.User, error) {
+	started := time.Now()
+	user, err := r.IRepository.GetByLogin(ctx, login)
+	observeQuery("GetByLogin", started, err)
+	return user, err
+}
+
+func (r *instrumentedRepository) UpdatePassword(ctx context.Context, user *repository.User) error {
+	started := time.Now()
+	err := r.IRepository.UpdatePassword(ctx, user)
+	observeQuery("UpdatePassword", started, err)
+	return err
+}
+
+func (r *instrumentedRepository) CreatePasswordReset(ctx context.Context, userID int64, tokenHash string, ttl time.Duration) error {
+	started := time.Now()
+	err := r.IRepository.CreatePasswordReset(ctx, userID, tokenHash, ttl)
+	observeQuery("CreatePasswordReset", started, err)
+	return err
+}
+
+func (r *instrumentedRepository) ResetPassword(ctx context.Context, tokenHash string, password string) (int64, error) {
+	started := time.Now()
+	userID, err := r.IRepository.ResetPassword(ctx, tokenHash, password)
+	observeQuery("ResetPassword", started, err)
+	return userID, err
+}
+
+func (r *instrumentedRepository) AddAuditEntry(ctx context.Context, entry *repository.AuditEntry) error {
+	started := time.Now()
+	err := r.IRepository.AddAuditEntry(ctx, entry)
+	observeQuery("AddAuditEntry", started, err)
+	return err
+}
+
+func (r *instrumentedRepository) GetUserAuditEntries(ctx context.Context, userID int64, limit int) ([]*repository.AuditEntry, error) {
+	started := time.Now()
+	entries, err := r.IRepository.GetUserAuditEntries(ctx, userID, limit)
+	observeQuery("GetUserAuditEntries", started, err)
+	return entries, err
+}
+
+func (r *instrumentedRepository) SaveSession(ctx context.Context, session *repository.UserSession) error {
+	started := time.Now()
+	err := r.IRepository.SaveSession(ctx, session)
+	observeQuery("SaveSession", started, err)
+	return err
+}
+
+func (r *instrumentedRepository) TouchSession(ctx context.Context, id string, ip string, userAgent string) (bool, error) {
+	started := time.Now()
+	ok, err := r.IRepository.TouchSession(ctx, id, ip, userAgent)
+	observeQuery("TouchSession", started, err)
+	return ok, err
+}
+
+func (r *instrumentedRepository) IsSessionActive(ctx context.Context, id string) (bool, error) {
+	started := time.Now()
+	ok, err := r.IRepository.IsSessionActive(ctx, id)
+	observeQuery("IsSessionActive", started, err)
+	return ok, err
+}
+
+func (r *instrumentedRepository) GetUserSessions(ctx context.Context, userID int64) ([]*repository.UserSession, error) {
+	started := time.Now()
+	sessions, err := r.IRepository.GetUserSessions(ctx, userID)
+	observeQuery("GetUserSessions", started, err)
+	return sessions, err
+}
+
+func (r *instrumentedRepository) RevokeSession(ctx context.Context, userID int64, id string) (string, error) {
+	started := time.Now()
+	token, err := r.IRepository.RevokeSession(ctx, userID, id)
+	observeQuery("RevokeSession", started, err)
+	return token, err
+}
+
+func (r *instrumentedRepository) RevokeUserSessions(ctx context.Context, userID int64, exceptID string) ([]string, error) {
+	started := time.Now()
+	tokens, err := r.IRepository.RevokeUserSessions(ctx, userID, exceptID)
+	observeQuery("RevokeUserSessions", started, err)
+	return tokens, err
+}
+
+func (r *instrumentedRepository) DeleteExpiredSessions(ctx context.Context) (int64, error) {
+	started := time.Now()
+	n, err := r.IRepository.DeleteExpiredSessions(ctx)
+	observeQuery("DeleteExpiredSessions", started, err)
+	return n, err
+}
+
+func (r *instrumentedRepository) GetTOTP(ctx context.Context, userID int64) (*repository.TOTP, error) {
+	started := time.Now()
+	totp, err := r.IRepository.GetTOTP(ctx, userID)
+	observeQuery("GetTOTP", started, err)
+	return totp, err
+}
+
+func (r *instrumentedRepository) EnableTOTP(ctx context.Context, userID int64, secret string, step int64, recoveryCodeHashes []string) error {
+	started := time.Now()
+	err := r.IRepository.EnableTOTP(ctx, userID, secret, step, recoveryCodeHashes)
+	observeQuery("EnableTOTP", started, err)
+	return err
+}
+
+func (r *instrumentedRepository) DisableTOTP(ctx context.Context, userID int64) error {
+	started := time.Now()
+	err := r.IRepository.DisableTOTP(ctx, userID)
+	observeQuery("DisableTOTP", started, err)
+	return err
+}
+
+func (r *instrumentedRepository) UseTOTPStep(ctx context.Context, userID int64, step int64) (bool, error) {
+	started := time.Now()
+	ok, err := r.IRepository.UseTOTPStep(ctx, userID, step)
+	observeQuery("UseTOTPStep", started, err)
+	return ok, err
+}
+
+func (r *instrumentedRepository) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	started := time.Now()
+	ok, err := r.IRepository.UseRecoveryCode(ctx, userID, codeHash)
+	observeQuery("UseRecoveryCode", started, err)
+	return ok, err
+}
+
+func (r *instrumentedRepository) CountRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	started := time.Now()
+	n, err := r.IRepository.CountRecoveryCodes(ctx, userID)
+	observeQuery("CountRecoveryCodes", started, err)
+	return n, err
+}
+
+func (r *instrumentedRepository) FindUsers(ctx context.Context, query string, limit int, afterID int64) ([]*repository.User, error) {
+	started := time.Now()
+	users, err := r.IRepository.FindUsers(ctx, query, limit, afterID)
+	observeQuery("FindUsers", started, err)
+	return users, err
+}
+
+func (r *instrumentedRepository) SetRole(ctx context.Context, userID int64, role string) error {
+	started := time.Now()
+	err := r.IRepository.SetRole(ctx, userID, role)
+	observeQuery("SetRole", started, err)
+	return err
+}
+
+func (r *instrumentedRepository) SetBlocked(ctx context.Context, userID int64, blocked bool) error {
+	started := time.Now()
+	err := r.IRepository.SetBlocked(ctx, userID, blocked)
+	observeQuery("SetBlocked", started, err)
+	return err
+}
+
+func (r *instrumentedRepository) IncrementSessionVersion(ctx context.Context, userID int64) error {
+	started := time.Now()
+	err := r.IRepository.IncrementSessionVersion(ctx, userID)
+	observeQuery("IncrementSessionVersion", started, err)
+	return err
+}
+
+func (r *instrumentedRepository) BulkCreate(ctx context.Context, users []*repository.User) {
+	started := time.Now()
+	r.IRepository.BulkCreate(ctx, users)
+	observeQuery("BulkCreate", started, nil)
+}
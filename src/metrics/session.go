@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"github.com/alexedwards/scs/v2"
+	"time"
+)
+
+type sessionStore struct {
+	scs.Store
+}
+
+// InstrumentSessionStore observes latency of the session store operations
+func InstrumentSessionStore(store scs.Store) scs.Store {
+	return &sessionStore{Store: store}
+}
+
+func (s *sessionStore) Find(token string) ([]byte, bool, error) {
+	started := time.Now()
+	b, found, err := s.Store.Find(token)
+	sessionDuration.WithLabelValues("find", result(err)).Observe(since(started))
+	return b, found, err
+}
+
+func (s *sessionStore) Commit(token string, b []byte, expiry time.Time) error {
+	started := time.Now()
+	err := s.Store.Commit(token, b, expiry)
+	sessionDuration.WithLabelValues("commit", result(err)).Observe(since(started))
+	return err
+}
+
+func (s *sessionStore) Delete(token string) error {
+	started := time.Now()
+	err := s.Store.Delete(token)
+	sessionDuration.WithLabelValues("delete", result(err)).Observe(since(started))
+	return err
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"mime/multipart"
+	"otus-hiload/src/file_storage"
+)
+
+type fileStorage struct {
+	file_storage.IFileStorage
+}
+
+// InstrumentFileStorage observes sizes of uploaded files and counts failed uploads
+func InstrumentFileStorage(storage file_storage.IFileStorage) file_storage.IFileStorage {
+	return &fileStorage{IFileStorage: storage}
+}
+
+func (s *fileStorage) SaveFile(ctx context.Context, file multipart.File, fileName string) (string, error) {
+	size, err := file.Seek(0, io.SeekEnd)
+	if err == nil {
+		uploadSize.Observe(float64(size))
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		uploadFailures.Inc()
+		return "", err
+	}
+
+	fName, err := s.IFileStorage.SaveFile(ctx, file, fileName)
+	if err != nil {
+		uploadFailures.Inc()
+	}
+	return fName, err
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"otus-hiload/src/logger"
+	"otus-hiload/src/statuswriter"
+	"time"
+)
+
+type accessInfoKey struct{}
+
+// accessInfo is filled by the inner handlers for the access log line
+type accessInfo struct {
+	userID int64
+}
+
+// AccessLogHandler logs a line per request: method, route template, status, response bytes, duration and user id
+func AccessLogHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		info := new(accessInfo)
+		aw := statuswriter.Wrap(w)
+		h.ServeHTTP(aw, r.WithContext(context.WithValue(r.Context(), accessInfoKey{}, info)))
+
+		route := routeTemplate(r)
+
+		fields := []interface{}{
+			"method", r.Method,
+			"route", route,
+			"status", aw.Status(),
+			"bytes", aw.Bytes(),
+			"duration_ms", float64(time.Since(started).Microseconds()) / 1000,
+		}
+		if info.userID != 0 {
+			fields = append(fields, "user_id", info.userID)
+		}
+		logger.FromContext(r.Context()).Info("access", fields...)
+	})
+}
+
+// setAccessUserID records the authenticated user for the access log
+func setAccessUserID(ctx context.Context, userID int64) {
+	if info, ok := ctx.Value(accessInfoKey{}).(*accessInfo); ok {
+		info.userID = userID
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"github.com/alexedwards/scs/v2"
 	"net/http"
 	"otus-hiload/src/constants"
+	"otus-hiload/src/i18n"
+	"otus-hiload/src/logger"
+	"strings"
 )
 
 func AuthHandler(h http.Handler, sessionManager *scs.SessionManager) http.Handler {
@@ -12,12 +15,19 @@ func AuthHandler(h http.Handler, sessionManager *scs.SessionManager) http.Handle
 		auth := sessionManager.GetBool(r.Context(), constants.CtxAuthenticated)
 
 		if !auth {
+			if strings.HasPrefix(r.URL.Path, constants.APIPrefix) {
+				// API clients get the status instead of the login page
+				writeError(w, r, http.StatusUnauthorized, i18n.FromContext(r.Context()).T("error.unauthorized"))
+				return
+			}
 			http.Redirect(w, r, constants.LoginPath, http.StatusFound)
 			return
 		}
 
 		userID := sessionManager.Get(r.Context(), constants.CtxUserId).(int64)
-		newRequest := r.WithContext(context.WithValue(r.Context(), constants.CtxUserId, userID))
+		setAccessUserID(r.Context(), userID)
+		ctx := logger.WithContext(r.Context(), logger.FromContext(r.Context()).With("user_id", userID))
+		newRequest := r.WithContext(context.WithValue(ctx, constants.CtxUserId, userID))
 		*r = *newRequest
 
 		h.ServeHTTP(w, r)
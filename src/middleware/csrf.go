@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"github.com/alexedwards/scs/v2"
+	"net/http"
+	"otus-hiload/src/constants"
+	"otus-hiload/src/i18n"
+	"otus-hiload/src/logger"
+	"strings"
+)
+
+const csrfTokenSize = 32
+
+// CSRFHandler rejects state-changing requests without the synchronizer token of the session.
+// The token is sent in the csrf_token form field or the X-CSRF-Token header.
+// API requests without the session cookie are exempt (bearer token clients, the registration): the attack rides
+// on the cookie the browser attaches by itself, such a request has none. API clients with the cookie get the token
+// from GET /api/v1/csrf.
+func CSRFHandler(sessionManager *scs.SessionManager) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isSafeMethod(r.Method) || isCookielessAPIRequest(r, sessionManager) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			expected := sessionManager.GetString(r.Context(), constants.CtxCSRFToken)
+			actual, err := requestCSRFToken(w, r)
+			if err != nil {
+				logger.FromContext(r.Context()).Info("csrf form parse", "error", err)
+				csrfError(w, r, http.StatusBadRequest, "csrf.form_parse")
+				return
+			}
+			if len(expected) == 0 || subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) != 1 {
+				logger.FromContext(r.Context()).Info("csrf token mismatch", "method", r.Method, "path", r.URL.Path)
+				csrfError(w, r, http.StatusForbidden, "csrf.invalid")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CSRFToken returns the token of the session, it is created on first use
+func CSRFToken(ctx context.Context, sessionManager *scs.SessionManager) (string, error) {
+	token := sessionManager.GetString(ctx, constants.CtxCSRFToken)
+	if len(token) > 0 {
+		return token, nil
+	}
+	b := make([]byte, csrfTokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	sessionManager.Put(ctx, constants.CtxCSRFToken, token)
+	return token, nil
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// isCookielessAPIRequest is an API request not authenticated by the session cookie. The forms are never exempt:
+// a cross-site form post without the cookie would still log the victim in to the attacker's account.
+func isCookielessAPIRequest(r *http.Request, sessionManager *scs.SessionManager) bool {
+	if !strings.HasPrefix(r.URL.Path, constants.APIPrefix) {
+		return false
+	}
+	_, err := r.Cookie(sessionManager.Cookie.Name)
+	return err != nil
+}
+
+// requestCSRFToken reads the token from the header, otherwise from the form.
+// Multipart forms are parsed here within the upload limit, the handler gets the parsed form.
+func requestCSRFToken(w http.ResponseWriter, r *http.Request) (string, error) {
+	if token := r.Header.Get(constants.CSRFHeader); len(token) > 0 {
+		return token, nil
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		r.Body = http.MaxBytesReader(w, r.Body, constants.MaxUploadSize+1<<20)
+		if err := r.ParseMultipartForm(constants.MaxUploadSize); err != nil {
+			return "", err
+		}
+		return r.PostFormValue(constants.CSRFField), nil
+	}
+	if err := r.ParseForm(); err != nil {
+		return "", err
+	}
+	return r.PostFormValue(constants.CSRFField), nil
+}
+
+func csrfError(w http.ResponseWriter, r *http.Request, status int, key string) {
+	writeError(w, r, status, i18n.FromContext(r.Context()).T(key))
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"github.com/alexedwards/scs/v2"
+	"net/http"
+	"net/http/httptest"
+	"otus-hiload/src/constants"
+	"strings"
+	"testing"
+)
+
+// csrfServer serves /token with the CSRF token of the session and accepts any other request behind CSRFHandler
+func csrfServer() (*scs.SessionManager, http.Handler) {
+	sessionManager := scs.New()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		token, _ := CSRFToken(r.Context(), sessionManager)
+		_, _ = w.Write([]byte(token))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return sessionManager, sessionManager.LoadAndSave(CSRFHandler(sessionManager)(mux))
+}
+
+func TestCSRFHandler(t *testing.T) {
+	sessionManager, h := csrfServer()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/token", nil))
+	token := rec.Body.String()
+	var cookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == sessionManager.Cookie.Name {
+			cookie = c
+		}
+	}
+	if len(token) == 0 || cookie == nil {
+		t.Fatalf("no token %q or session cookie", token)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		cookie bool
+		form   string
+		header string
+		want   int
+	}{
+		{"form without token", "POST", "/me/edit", true, "description=x", "", http.StatusForbidden},
+		{"form with a wrong token", "POST", "/me/edit", true, constants.CSRFField + "=wrong", "", http.StatusForbidden},
+		{"form with the token", "POST", "/me/edit", true, constants.CSRFField + "=" + token, "", http.StatusNoContent},
+		{"form without the cookie", "POST", "/login", false, "login=a", "", http.StatusForbidden},
+		{"api without the cookie", "POST", constants.APIUsersPath, false, "", "", http.StatusNoContent},
+		{"api with the cookie without token", "PUT", constants.APIMePath, true, "", "", http.StatusForbidden},
+		{"api with the cookie and the header", "PUT", constants.APIMePath, true, "", token, http.StatusNoContent},
+		{"safe method", "GET", "/me/edit", true, "", "", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.form))
+			if len(tt.form) > 0 {
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			if tt.cookie {
+				r.AddCookie(cookie)
+			}
+			if len(tt.header) > 0 {
+				r.Header.Set(constants.CSRFHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
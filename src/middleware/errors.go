@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"otus-hiload/src/constants"
+	"strings"
+)
+
+// writeError responds with the message as JSON to the API requests and as plain text to the rest,
+// the middlewares run before the pages could be rendered
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if strings.HasPrefix(r.URL.Path, constants.APIPrefix) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"status": status, "error": message})
+		return
+	}
+	http.Error(w, message, status)
+}
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"github.com/alexedwards/scs/v2"
+	"net/http"
+	"otus-hiload/src/constants"
+	"otus-hiload/src/i18n"
+)
+
+// LocaleHandler selects the locale of the request: the one chosen by the user and kept in the session,
+// otherwise the best match of Accept-Language
+func LocaleHandler(sessionManager *scs.SessionManager) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			locale := sessionManager.GetString(r.Context(), constants.CtxLocale)
+			if !i18n.IsSupported(locale) {
+				locale = i18n.FromAcceptLanguage(r)
+			}
+			w.Header().Set("Content-Language", locale)
+			next.ServeHTTP(w, r.WithContext(i18n.WithContext(r.Context(), i18n.New(locale))))
+		})
+	}
+}
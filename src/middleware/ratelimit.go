@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"github.com/alexedwards/scs/v2"
+	"github.com/gorilla/mux"
+	"net/http"
+	"otus-hiload/src/constants"
+	"otus-hiload/src/i18n"
+	"otus-hiload/src/logger"
+	"otus-hiload/src/metrics"
+	"otus-hiload/src/ratelimit"
+	"strconv"
+	"time"
+)
+
+// RateLimits are the token buckets checked for every request, nil ones are disabled.
+// IP applies to every request, User to authenticated ones, Routes to the requests of a route template
+// per user or ip, so expensive routes get a smaller budget than the rest.
+type RateLimits struct {
+	IP     *ratelimit.Limiter
+	User   *ratelimit.Limiter
+	Routes map[string]*ratelimit.Limiter
+}
+
+// RunCleanup drops the full buckets of every limiter in the background until stop is closed
+func (l RateLimits) RunCleanup(interval time.Duration, stop <-chan struct{}) {
+	limiters := []*ratelimit.Limiter{l.IP, l.User}
+	for _, limiter := range l.Routes {
+		limiters = append(limiters, limiter)
+	}
+	for _, limiter := range limiters {
+		if limiter != nil {
+			go limiter.RunCleanup(interval, stop)
+		}
+	}
+}
+
+// shedRetryAfter is sent with the shed requests, the limit is adjusted about once a second
+const shedRetryAfter = time.Second
+
+// LoadShedHandler rejects the requests above the concurrency limit with 503 before they load the session,
+// so an overloaded database gets less work instead of a longer queue
+func LoadShedHandler(limiter *ratelimit.AdaptiveLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := routeTemplate(r)
+			if !limiter.Acquire() {
+				metrics.ObserveRejected(route, "load_shed")
+				// the locale of the session is unknown yet, the session is not loaded for the shed requests
+				l := i18n.New(i18n.FromAcceptLanguage(r))
+				SetRetryAfter(w, shedRetryAfter)
+				writeError(w, r, http.StatusServiceUnavailable, l.T("error.overloaded"))
+				return
+			}
+			defer limiter.Release()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// IPRateLimitHandler rejects the requests of the ips which ran out of tokens with 429. It runs before the session
+// is loaded, so a flood from one address costs no session store reads.
+func IPRateLimitHandler(limits RateLimits) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := ClientIP(r)
+			if ok, wait := allow(limits.IP, ip); !ok {
+				// the locale of the session is unknown yet
+				rateLimited(w, r, "ip:"+ip, wait, i18n.New(i18n.FromAcceptLanguage(r)))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RateLimitHandler rejects the requests of the users and the requests of the limited routes which ran out of tokens
+// with 429. It needs the session but runs before the middlewares which query the database.
+func RateLimitHandler(sessionManager *scs.SessionManager, limits RateLimits) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := "ip:" + ClientIP(r)
+			ok, wait := true, time.Duration(0)
+			if sessionManager.GetBool(r.Context(), constants.CtxAuthenticated) {
+				if userID, isSet := sessionManager.Get(r.Context(), constants.CtxUserId).(int64); isSet {
+					client = "user:" + strconv.FormatInt(userID, 10)
+					ok, wait = allow(limits.User, client)
+				}
+			}
+			if ok {
+				ok, wait = allow(limits.Routes[routeTemplate(r)], client)
+			}
+			if !ok {
+				rateLimited(w, r, client, wait, i18n.FromContext(r.Context()))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func rateLimited(w http.ResponseWriter, r *http.Request, client string, wait time.Duration, l *i18n.Localizer) {
+	route := routeTemplate(r)
+	metrics.ObserveRejected(route, "rate_limit")
+	logger.FromContext(r.Context()).Info("rate limited", "client", client, "route", route)
+	SetRetryAfter(w, wait)
+	writeError(w, r, http.StatusTooManyRequests, l.T("error.rate_limited"))
+}
+
+func allow(limiter *ratelimit.Limiter, key string) (bool, time.Duration) {
+	if limiter == nil {
+		return true, 0
+	}
+	return limiter.Allow(key)
+}
+
+// RetryAfterSeconds rounds the wait up, Retry-After is in whole seconds
+func RetryAfterSeconds(wait time.Duration) int {
+	return int((wait + time.Second - 1) / time.Second)
+}
+
+// SetRetryAfter tells the client to retry the request after the wait
+func SetRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(RetryAfterSeconds(wait)))
+}
+
+// routeTemplate is the template of the matched mux route, the path if none matched
+func routeTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if tpl, err := current.GetPathTemplate(); err == nil {
+			return tpl
+		}
+	}
+	return r.URL.Path
+}
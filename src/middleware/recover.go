@@ -2,8 +2,9 @@ package middleware
 
 import (
 	"errors"
-	"log"
 	"net/http"
+	"otus-hiload/src/i18n"
+	"otus-hiload/src/logger"
 	"runtime"
 )
 
@@ -15,9 +16,9 @@ func RecoverHandler(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var err error
 		defer func() {
-			r := recover()
-			if r != nil {
-				switch t := r.(type) {
+			rec := recover()
+			if rec != nil {
+				switch t := rec.(type) {
 				case string:
 					err = errors.New(t)
 				case error:
@@ -27,8 +28,9 @@ func RecoverHandler(h http.Handler) http.Handler {
 				}
 				stack := make([]byte, StackSize)
 				length := runtime.Stack(stack, false)
-				log.Printf("[PANIC RECOVER]: %v %s\n", err, stack[:length])
-				http.Error(w, "внутренняя ошибка сервера", http.StatusInternalServerError)
+				logger.FromContext(r.Context()).Error("panic recovered", "error", err, "stack", string(stack[:length]))
+				// the recover handler runs before the session is loaded, so only the browser language is known
+				http.Error(w, i18n.New(i18n.FromAcceptLanguage(r)).T("error.internal"), http.StatusInternalServerError)
 			}
 		}()
 		h.ServeHTTP(w, r)
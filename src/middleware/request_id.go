@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	uuid "github.com/satori/go.uuid"
+	"net/http"
+	"otus-hiload/src/logger"
+	"regexp"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+var requestIDRe = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestIDHandler propagates the X-Request-ID of the incoming request (or assigns a new one) to the response
+// and attaches it to the request logger, so every line logged while serving the request carries it
+func RequestIDHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !requestIDRe.MatchString(requestID) {
+			requestID = uuid.NewV4().String()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		l := logger.FromContext(r.Context()).With("request_id", requestID)
+		h.ServeHTTP(w, r.WithContext(logger.WithContext(r.Context(), l)))
+	})
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"context"
+	"github.com/alexedwards/scs/v2"
+	"net/http"
+	"otus-hiload/src/constants"
+	"otus-hiload/src/i18n"
+	"otus-hiload/src/logger"
+	"otus-hiload/src/roles"
+)
+
+// RoleFunc returns the current role of the user
+type RoleFunc func(ctx context.Context, userID int64) (string, error)
+
+// RoleHandler is AuthHandler which also requires at least the role. The role is read on every request,
+// not taken from the session, so a revoked role stops working at once.
+func RoleHandler(h http.Handler, sessionManager *scs.SessionManager, required string, role RoleFunc) http.Handler {
+	return AuthHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID := ctx.Value(constants.CtxUserId).(int64)
+		current, err := role(ctx, userID)
+		if err != nil {
+			logger.FromContext(ctx).Error("user role", "error", err)
+			writeError(w, r, http.StatusServiceUnavailable, i18n.FromContext(ctx).T("error.unavailable"))
+			return
+		}
+		if !roles.AtLeast(current, required) {
+			logger.FromContext(ctx).Info("access denied", "role", current, "required", required)
+			writeError(w, r, http.StatusForbidden, i18n.FromContext(ctx).T("error.forbidden"))
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(ctx, constants.CtxUserRole, current)))
+	}), sessionManager)
+}
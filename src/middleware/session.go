@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"github.com/alexedwards/scs/v2"
+	"net/http"
+	"otus-hiload/src/constants"
+	"otus-hiload/src/logger"
+	"otus-hiload/src/tracing"
+	"time"
+)
+
+// SessionTokenFunc is called after a new or renewed session is saved, r carries the session context.
+// The token is empty for the sessions kept in the cookie: there is no server side token to delete,
+// and the other saves, which only re-encode the cookie, are not reported.
+type SessionTokenFunc func(r *http.Request, token string, expiry time.Time)
+
+// SessionCookieEncoder is the session store keeping the session data in the cookie itself:
+// the cookie carries the encoded data instead of a token
+type SessionCookieEncoder interface {
+	EncodeCookie(b []byte, expiry time.Time) (string, error)
+}
+
+// SessionHandler loads and saves the session like scs.SessionManager.LoadAndSave,
+// but with the request context, so the store round trips are traced and logged with the request id.
+// onNewToken is optional, it is the only place the renewed token of a session is known.
+func SessionHandler(sessionManager *scs.SessionManager, onNewToken SessionTokenFunc) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var token string
+			cookie, err := r.Cookie(sessionManager.Cookie.Name)
+			if err == nil {
+				token = cookie.Value
+			}
+
+			_, span := tracing.Start(r.Context(), "session.load")
+			ctx, err := sessionManager.Load(r.Context(), token)
+			span.SetError(err)
+			span.End()
+			if err != nil {
+				logger.FromContext(r.Context()).Error("session load", "error", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			sr := r.WithContext(ctx)
+			bw := &bufferedResponseWriter{ResponseWriter: w}
+			h.ServeHTTP(bw, sr)
+
+			switch sessionManager.Status(ctx) {
+			case scs.Modified:
+				_, span := tracing.Start(sr.Context(), "session.save")
+				newToken, expiry, err := sessionManager.Commit(ctx)
+				// the store token changes for a new or renewed session only, the cookie value on every change
+				renewed := newToken != token
+				value := newToken
+				encoder, inCookie := sessionManager.Store.(SessionCookieEncoder)
+				if err == nil && inCookie {
+					value, err = encodeSessionCookie(ctx, sessionManager, encoder, expiry)
+				}
+				span.SetError(err)
+				span.End()
+				if err != nil {
+					logger.FromContext(r.Context()).Error("session save", "error", err)
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+					return
+				}
+				if renewed && onNewToken != nil {
+					if inCookie {
+						onNewToken(sr, "", expiry)
+					} else {
+						onNewToken(sr, newToken, expiry)
+					}
+				}
+				writeSessionCookie(w, sessionManager, value, expiry)
+			case scs.Destroyed:
+				writeSessionCookie(w, sessionManager, "", time.Time{})
+			}
+
+			if bw.code != 0 {
+				w.WriteHeader(bw.code)
+			}
+			_, _ = w.Write(bw.buf.Bytes())
+		})
+	}
+}
+
+// encodeSessionCookie encodes the session values with the codec of the session manager, like Commit does for the store
+func encodeSessionCookie(ctx context.Context, sessionManager *scs.SessionManager, encoder SessionCookieEncoder,
+	expiry time.Time) (string, error) {
+	values := make(map[string]interface{})
+	for _, key := range sessionManager.Keys(ctx) {
+		values[key] = sessionManager.Get(ctx, key)
+	}
+	b, err := sessionManager.Codec.Encode(expiry, values)
+	if err != nil {
+		return "", err
+	}
+	return encoder.EncodeCookie(b, expiry)
+}
+
+// SignOut drops the authentication of the session under a new token. The session keeps its locale
+// and CSRF token, so the page the user is on still works.
+func SignOut(ctx context.Context, sessionManager *scs.SessionManager) error {
+	if err := sessionManager.RenewToken(ctx); err != nil {
+		return err
+	}
+	sessionManager.Put(ctx, constants.CtxAuthenticated, false)
+	sessionManager.Remove(ctx, constants.CtxUserId)
+	sessionManager.Remove(ctx, constants.CtxSessionVersion)
+	sessionManager.Remove(ctx, constants.CtxSessionID)
+	sessionManager.Remove(ctx, constants.CtxSessionSeen)
+	sessionManager.Remove(ctx, constants.CtxUserRole)
+	return nil
+}
+
+func writeSessionCookie(w http.ResponseWriter, sessionManager *scs.SessionManager, token string, expiry time.Time) {
+	cookie := &http.Cookie{
+		Name:     sessionManager.Cookie.Name,
+		Value:    token,
+		Path:     sessionManager.Cookie.Path,
+		Domain:   sessionManager.Cookie.Domain,
+		Secure:   sessionManager.Cookie.Secure,
+		HttpOnly: sessionManager.Cookie.HttpOnly,
+		SameSite: sessionManager.Cookie.SameSite,
+	}
+
+	if expiry.IsZero() {
+		cookie.Expires = time.Unix(1, 0)
+		cookie.MaxAge = -1
+	} else if sessionManager.Cookie.Persist {
+		cookie.Expires = time.Unix(expiry.Unix()+1, 0)
+		cookie.MaxAge = int(time.Until(expiry).Seconds() + 1)
+	}
+
+	w.Header().Add("Set-Cookie", cookie.String())
+	w.Header().Add("Cache-Control", `no-cache="Set-Cookie"`)
+	w.Header().Add("Vary", "Cookie")
+}
+
+// bufferedResponseWriter holds the response until the session is saved, the cookie header must precede the body
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+	buf  bytes.Buffer
+	code int
+}
+
+func (bw *bufferedResponseWriter) Write(b []byte) (int, error) {
+	return bw.buf.Write(b)
+}
+
+func (bw *bufferedResponseWriter) WriteHeader(code int) {
+	bw.code = code
+}
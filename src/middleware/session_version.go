@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"context"
+	"github.com/alexedwards/scs/v2"
+	"net/http"
+	"otus-hiload/src/constants"
+	"otus-hiload/src/i18n"
+	"otus-hiload/src/logger"
+)
+
+// SessionVersionFunc returns the current session version of the user
+type SessionVersionFunc func(ctx context.Context, userID int64) (int, error)
+
+// SessionVersionHandler signs out the sessions created before the session version of the user changed,
+// e.g. by a password change. The session keeps its locale and CSRF token, only the authentication is dropped.
+func SessionVersionHandler(sessionManager *scs.SessionManager, version SessionVersionFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if !sessionManager.GetBool(ctx, constants.CtxAuthenticated) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			userID, _ := sessionManager.Get(ctx, constants.CtxUserId).(int64)
+			current, err := version(ctx, userID)
+			if err != nil {
+				logger.FromContext(ctx).Error("session version", "error", err)
+				writeError(w, r, http.StatusServiceUnavailable, i18n.FromContext(ctx).T("error.unavailable"))
+				return
+			}
+			if sessionManager.GetInt(ctx, constants.CtxSessionVersion) != current {
+				logger.FromContext(ctx).Info("session signed out", "user_id", userID, "reason", "session version")
+				if err := SignOut(ctx, sessionManager); err != nil {
+					logger.FromContext(ctx).Error("session renew", "error", err)
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
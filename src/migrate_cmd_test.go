@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestRunMigrateUsage(t *testing.T) {
+	// every case fails before connecting to the database
+	tests := [][]string{
+		{},
+		{"sideways"},
+		{"up", "0"},
+		{"up", "-1"},
+		{"up", "two"},
+		{"down", "0"},
+		{"down", "-2"},
+		{"goto"},
+		{"goto", "-1"},
+		{"force"},
+		{"status", "1"},
+		{"up", "1", "2"},
+	}
+	for _, args := range tests {
+		if got := runMigrate(args); got != 2 {
+			t.Errorf("runMigrate(%q) = %d, want 2", args, got)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Message is a plain text message to the user
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier delivers messages to the users, e.g. the password reset links
+type Notifier interface {
+	Notify(ctx context.Context, msg *Message) error
+}
+
+// New creates the notifier by its spec: "log", "file:<path>" or "smtp://[user:password@]host:port",
+// from is the sender address of the smtp messages
+func New(spec string, from string) (Notifier, error) {
+	switch {
+	case spec == "log":
+		return NewLogNotifier(), nil
+	case strings.HasPrefix(spec, "file:"):
+		return NewFileNotifier(strings.TrimPrefix(spec, "file:")), nil
+	case strings.HasPrefix(spec, "smtp://"):
+		u, err := url.Parse(spec)
+		if err != nil {
+			return nil, fmt.Errorf("notifier: %w", err)
+		}
+		if len(from) == 0 {
+			return nil, fmt.Errorf("notifier: the sender address is required for smtp")
+		}
+		return NewSMTPNotifier(u.Host, u.User, from), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier %q", spec)
+	}
+}
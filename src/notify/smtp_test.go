@@ -0,0 +1,166 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTP is an smtp server without STARTTLS and AUTH, it records the commands and the message of one session
+type fakeSMTP struct {
+	ln       net.Listener
+	commands []string
+	data     string
+	done     chan struct{}
+}
+
+func startFakeSMTP(t *testing.T) *fakeSMTP {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &fakeSMTP{ln: ln, done: make(chan struct{})}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *fakeSMTP) serve() {
+	defer close(s.done)
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		_, _ = conn.Write([]byte(line + "\r\n"))
+	}
+	reply("220 fake ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		s.commands = append(s.commands, line)
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO":
+			reply("250-fake")
+			reply("250 8BITMIME")
+		case "MAIL", "RCPT":
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			s.data = data.String()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestSMTPNotifierNotify(t *testing.T) {
+	server := startFakeSMTP(t)
+	msg := &Message{
+		To:      "user@example.com",
+		Subject: "Восстановление пароля",
+		Body: "Здравствуйте, Иван!\n\nПерейдите по ссылке, чтобы задать новый пароль:\n" +
+			"http://localhost:8080/password/reset/confirm?token=" + strings.Repeat("a", 60) + "=x",
+	}
+
+	n := NewSMTPNotifier(server.ln.Addr().String(), nil, "noreply@example.com")
+	if err := n.Notify(context.Background(), msg); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	<-server.done
+
+	wantCommands := []string{"MAIL FROM:<noreply@example.com>", "RCPT TO:<user@example.com>", "DATA", "QUIT"}
+	var got []string
+	for _, c := range server.commands {
+		if !strings.HasPrefix(c, "EHLO") {
+			got = append(got, strings.SplitN(c, " BODY=", 2)[0])
+		}
+	}
+	if strings.Join(got, "\n") != strings.Join(wantCommands, "\n") {
+		t.Errorf("commands = %q, want %q", got, wantCommands)
+	}
+	for _, c := range server.commands {
+		if strings.HasPrefix(strings.ToUpper(c), "STARTTLS") || strings.HasPrefix(strings.ToUpper(c), "AUTH") {
+			t.Errorf("unexpected command %q: the server offers neither STARTTLS nor AUTH", c)
+		}
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(server.data))
+	if err != nil {
+		t.Fatalf("read message: %v", err)
+	}
+	rawSubject := parsed.Header.Get("Subject")
+	if !strings.HasPrefix(rawSubject, "=?utf-8?q?") {
+		t.Errorf("Subject = %q, want Q-encoded", rawSubject)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(rawSubject)
+	if err != nil || subject != msg.Subject {
+		t.Errorf("decoded Subject = %q, %v, want %q", subject, err, msg.Subject)
+	}
+	for header, want := range map[string]string{
+		"From":                      "noreply@example.com",
+		"To":                        "user@example.com",
+		"Content-Type":              "text/plain; charset=utf-8",
+		"Content-Transfer-Encoding": "quoted-printable",
+	} {
+		if got := parsed.Header.Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+
+	raw, err := ioutil.ReadAll(parsed.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	for _, line := range strings.Split(string(raw), "\r\n") {
+		if len(line) > 76 {
+			t.Errorf("body line of %d chars, quoted-printable lines are at most 76", len(line))
+		}
+	}
+	body, err := ioutil.ReadAll(quotedprintable.NewReader(strings.NewReader(string(raw))))
+	if err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	// the text body goes with CRLF line breaks
+	want := strings.Replace(msg.Body, "\n", "\r\n", -1)
+	if got := strings.TrimRight(string(body), "\r\n"); got != want {
+		t.Errorf("decoded body = %q, want %q", got, want)
+	}
+}
+
+func TestSMTPNotifierNoRecipient(t *testing.T) {
+	n := NewSMTPNotifier("127.0.0.1:1", nil, "noreply@example.com")
+	if err := n.Notify(context.Background(), &Message{Subject: "s", Body: "b"}); err == nil {
+		t.Error("Notify() without a recipient: no error")
+	}
+}
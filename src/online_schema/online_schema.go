@@ -0,0 +1,506 @@
+package online_schema
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options of the online schema change.
+//
+// The change is done without locking the table for writes:
+//   - a shadow table is created as a copy of the table structure and the ALTER is applied to it;
+//   - triggers on the original table replay every insert/update/delete on the shadow table;
+//   - existing rows are copied to the shadow table in primary key chunks, throttled by replica lag;
+//   - the tables are swapped with a single atomic RENAME TABLE.
+type Options struct {
+	// Table to change, must have a single column integer primary key
+	Table string
+	// Alter is the ALTER TABLE specification, e.g. "ADD last_name varchar(255) not null after name"
+	Alter string
+	// ChunkSize is the number of primary key values copied by one statement
+	ChunkSize int64
+	// ChunkPause is slept after each chunk to leave room for the regular workload
+	ChunkPause time.Duration
+	// MaxReplicaLag pauses copying while any of Replicas is lagging more
+	MaxReplicaLag time.Duration
+	Replicas      []*sql.DB
+	// KeepOldTable leaves the original table renamed to _<table>_old after the swap
+	KeepOldTable bool
+}
+
+// Estimate is the result of a dry run
+type Estimate struct {
+	Rows        int64
+	Chunks      int64
+	SampledRows int64
+	ChunkTime   time.Duration
+	Duration    time.Duration
+}
+
+var alterRe = regexp.MustCompile("(?is)^\\s*ALTER\\s+TABLE\\s+`?(\\w+)`?\\s+(.+?)[\\s;]*$")
+
+// ParseAlter splits a single "ALTER TABLE <table> <specification>" statement
+func ParseAlter(statement string) (table string, alter string, err error) {
+	match := alterRe.FindStringSubmatch(statement)
+	if match == nil || strings.Contains(match[2], ";") {
+		return "", "", errors.New("online schema change supports a single ALTER TABLE statement only")
+	}
+	return match[1], match[2], nil
+}
+
+type change struct {
+	db        *sql.DB
+	opts      Options
+	shadow    string
+	old       string
+	pk        string
+	columns   []string
+	triggers  []string
+	minID     int64
+	maxID     int64
+	chunkTime time.Duration
+}
+
+// planChange applies the option defaults and names the helper tables, it does not query the database
+func planChange(db *sql.DB, opts Options) *change {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = 1000
+	}
+	return &change{
+		db:     db,
+		opts:   opts,
+		shadow: "_" + opts.Table + "_new",
+		old:    "_" + opts.Table + "_old",
+	}
+}
+
+func newChange(ctx context.Context, db *sql.DB, opts Options) (*change, error) {
+	c := planChange(db, opts)
+
+	pk, err := c.primaryKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.pk = pk
+
+	for _, name := range []string{c.shadow, c.old} {
+		exists, err := c.tableExists(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, fmt.Errorf("table %s exists, it is left by an unfinished change and must be dropped by hand", name)
+		}
+	}
+
+	return c, nil
+}
+
+// Run performs the change, on failure before the swap the original table stays untouched
+func Run(ctx context.Context, db *sql.DB, opts Options) (err error) {
+	c, err := newChange(ctx, db, opts)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			c.cleanup()
+		}
+	}()
+
+	if err = c.createShadow(ctx); err != nil {
+		return err
+	}
+	if err = c.createTriggers(ctx); err != nil {
+		return err
+	}
+	if err = c.copyRows(ctx, 0); err != nil {
+		return err
+	}
+	return c.swap(ctx)
+}
+
+// DryRun validates the ALTER on an empty shadow table, copies a few sample chunks into it
+// and extrapolates the copy duration to the whole table. The original table is not changed.
+func DryRun(ctx context.Context, db *sql.DB, opts Options, sampleChunks int64) (*Estimate, error) {
+	c, err := newChange(ctx, db, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer c.cleanup()
+
+	if err = c.createShadow(ctx); err != nil {
+		return nil, err
+	}
+	if err = c.copyRows(ctx, sampleChunks); err != nil {
+		return nil, err
+	}
+
+	var rows, sampledRows int64
+	err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM `"+c.shadow+"`").Scan(&sampledRows)
+	if err != nil {
+		return nil, err
+	}
+	err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM `"+c.opts.Table+"`").Scan(&rows)
+	if err != nil {
+		return nil, err
+	}
+	return c.estimate(rows, sampledRows, sampleChunks), nil
+}
+
+// chunks is the number of primary key chunks between minID and maxID, zero for an empty table
+func (c *change) chunks() int64 {
+	if c.maxID == 0 {
+		return 0
+	}
+	return (c.maxID - c.minID + c.opts.ChunkSize) / c.opts.ChunkSize
+}
+
+// estimate extrapolates the time of the copied sample chunks to all the chunks, the pauses included
+func (c *change) estimate(rows int64, sampledRows int64, sampleChunks int64) *Estimate {
+	estimate := &Estimate{Rows: rows, SampledRows: sampledRows, Chunks: c.chunks()}
+	copied := sampleChunks
+	if copied <= 0 || copied > estimate.Chunks {
+		// copyRows copies everything without a limit
+		copied = estimate.Chunks
+	}
+	if copied > 0 {
+		estimate.ChunkTime = c.chunkTime / time.Duration(copied)
+	}
+	estimate.Duration = time.Duration(estimate.Chunks) * (estimate.ChunkTime + c.opts.ChunkPause)
+	return estimate
+}
+
+func (c *change) primaryKey(ctx context.Context) (string, error) {
+	rows, err := c.db.QueryContext(ctx, "SELECT k.COLUMN_NAME, c.DATA_TYPE FROM information_schema.KEY_COLUMN_USAGE k "+
+		"JOIN information_schema.COLUMNS c ON c.TABLE_SCHEMA = k.TABLE_SCHEMA AND c.TABLE_NAME = k.TABLE_NAME AND c.COLUMN_NAME = k.COLUMN_NAME "+
+		"WHERE k.TABLE_SCHEMA = DATABASE() AND k.TABLE_NAME = ? AND k.CONSTRAINT_NAME = 'PRIMARY'", c.opts.Table)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	columns := make([]string, 0, 1)
+	var dataType string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column, &dataType); err != nil {
+			return "", err
+		}
+		columns = append(columns, column)
+	}
+	if err = rows.Err(); err != nil {
+		return "", err
+	}
+
+	if len(columns) != 1 || !strings.HasSuffix(strings.ToLower(dataType), "int") {
+		return "", fmt.Errorf("table %s must have a single column integer primary key", c.opts.Table)
+	}
+	return columns[0], nil
+}
+
+func (c *change) tableExists(ctx context.Context, table string) (bool, error) {
+	var count int
+	err := c.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?",
+		table).Scan(&count)
+	return count > 0, err
+}
+
+func (c *change) tableColumns(ctx context.Context, table string) ([]string, error) {
+	rows, err := c.db.QueryContext(ctx, "SELECT COLUMN_NAME FROM information_schema.COLUMNS "+
+		"WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make([]string, 0)
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+func (c *change) createShadow(ctx context.Context) error {
+	log.Printf("online schema: creating %s", c.shadow)
+	_, err := c.db.ExecContext(ctx, "CREATE TABLE `"+c.shadow+"` LIKE `"+c.opts.Table+"`")
+	if err != nil {
+		return err
+	}
+	_, err = c.db.ExecContext(ctx, "ALTER TABLE `"+c.shadow+"` "+c.opts.Alter)
+	if err != nil {
+		return fmt.Errorf("alter shadow table: %w", err)
+	}
+
+	// only the columns present in both tables are copied, added columns get their defaults
+	oldColumns, err := c.tableColumns(ctx, c.opts.Table)
+	if err != nil {
+		return err
+	}
+	newColumns, err := c.tableColumns(ctx, c.shadow)
+	if err != nil {
+		return err
+	}
+	c.columns, err = copiedColumns(oldColumns, newColumns, c.pk)
+	return err
+}
+
+// copiedColumns are the columns of the original table kept by the ALTER, in the original order
+func copiedColumns(oldColumns []string, newColumns []string, pk string) ([]string, error) {
+	kept := make(map[string]bool, len(newColumns))
+	for _, column := range newColumns {
+		kept[column] = true
+	}
+	if !kept[pk] {
+		return nil, fmt.Errorf("primary key column %s can not be dropped online", pk)
+	}
+	columns := make([]string, 0, len(oldColumns))
+	for _, column := range oldColumns {
+		if kept[column] {
+			columns = append(columns, column)
+		}
+	}
+	return columns, nil
+}
+
+func (c *change) createTriggers(ctx context.Context) error {
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// triggers keep the sql_mode they were created with: without strict mode new NOT NULL columns
+	// without a default get the implicit default instead of failing the writes to the original table
+	_, err = conn.ExecContext(ctx, "SET SESSION sql_mode = 'NO_ENGINE_SUBSTITUTION'")
+	if err != nil {
+		return err
+	}
+
+	for _, trigger := range c.triggerStatements() {
+		log.Printf("online schema: creating trigger %s", trigger.name)
+		_, err = conn.ExecContext(ctx, trigger.sql)
+		if err != nil {
+			return err
+		}
+		c.triggers = append(c.triggers, trigger.name)
+	}
+
+	return nil
+}
+
+type trigger struct {
+	name string
+	sql  string
+}
+
+// triggerStatements are the CREATE TRIGGER statements replaying the writes to the original table on the shadow one
+func (c *change) triggerStatements() []trigger {
+	columns := "`" + strings.Join(c.columns, "`, `") + "`"
+	newValues := "NEW.`" + strings.Join(c.columns, "`, NEW.`") + "`"
+	replace := fmt.Sprintf("REPLACE INTO `%s` (%s) VALUES (%s)", c.shadow, columns, newValues)
+
+	bodies := []struct {
+		suffix string
+		sql    string
+	}{
+		{"ins", "AFTER INSERT ON `%s` FOR EACH ROW " + replace},
+		{"upd", "AFTER UPDATE ON `%s` FOR EACH ROW BEGIN " +
+			fmt.Sprintf("DELETE FROM `%s` WHERE `%s` = OLD.`%s` AND OLD.`%s` <> NEW.`%s`; ", c.shadow, c.pk, c.pk, c.pk, c.pk) +
+			replace + "; END"},
+		{"del", "AFTER DELETE ON `%s` FOR EACH ROW " +
+			fmt.Sprintf("DELETE FROM `%s` WHERE `%s` = OLD.`%s`", c.shadow, c.pk, c.pk)},
+	}
+	triggers := make([]trigger, 0, len(bodies))
+	for _, body := range bodies {
+		name := fmt.Sprintf("_%s_osc_%s", c.opts.Table, body.suffix)
+		triggers = append(triggers, trigger{name: name, sql: "CREATE TRIGGER `" + name + "` " + fmt.Sprintf(body.sql, c.opts.Table)})
+	}
+	return triggers
+}
+
+// copyRows copies the rows existing at the start in primary key chunks, limit > 0 stops after limit chunks
+func (c *change) copyRows(ctx context.Context, limit int64) error {
+	err := c.db.QueryRowContext(ctx, fmt.Sprintf("SELECT COALESCE(MIN(`%s`), 0), COALESCE(MAX(`%s`), 0) FROM `%s`",
+		c.pk, c.pk, c.opts.Table)).Scan(&c.minID, &c.maxID)
+	if err != nil {
+		return err
+	}
+
+	query := c.chunkQuery()
+	total := c.chunks()
+	started := time.Now()
+	var chunk int64
+	for from := c.minID; c.maxID > 0 && from <= c.maxID; from += c.opts.ChunkSize {
+		if limit > 0 && chunk >= limit {
+			break
+		}
+		if err := c.throttle(ctx); err != nil {
+			return err
+		}
+
+		chunkStarted := time.Now()
+		_, err := c.db.ExecContext(ctx, query, from, from+c.opts.ChunkSize)
+		if err != nil {
+			return fmt.Errorf("copy chunk from %d: %w", from, err)
+		}
+		c.chunkTime += time.Since(chunkStarted)
+		chunk++
+
+		if chunk%100 == 0 {
+			elapsed := time.Since(started)
+			eta := time.Duration(float64(elapsed) / float64(chunk) * float64(total-chunk))
+			log.Printf("online schema: copied %d/%d chunks, elapsed %s, eta %s", chunk, total,
+				elapsed.Round(time.Second), eta.Round(time.Second))
+		}
+
+		if c.opts.ChunkPause > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(c.opts.ChunkPause):
+			}
+		}
+	}
+
+	log.Printf("online schema: copied %d chunks in %s", chunk, time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+// chunkQuery copies the rows with the primary key in [?, ?)
+func (c *change) chunkQuery() string {
+	columns := "`" + strings.Join(c.columns, "`, `") + "`"
+	// rows already written by the triggers are newer than the copied ones, IGNORE keeps them
+	return fmt.Sprintf("INSERT IGNORE INTO `%s` (%s) SELECT %s FROM `%s` WHERE `%s` >= ? AND `%s` < ? LOCK IN SHARE MODE",
+		c.shadow, columns, columns, c.opts.Table, c.pk, c.pk)
+}
+
+// throttle waits while any replica lags more than MaxReplicaLag
+func (c *change) throttle(ctx context.Context) error {
+	if c.opts.MaxReplicaLag <= 0 {
+		return nil
+	}
+	for {
+		lag, err := c.replicaLag(ctx)
+		if err != nil {
+			return err
+		}
+		if lag <= c.opts.MaxReplicaLag {
+			return nil
+		}
+		log.Printf("online schema: replica lag %s exceeds %s, waiting", lag, c.opts.MaxReplicaLag)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// replicaLag returns the maximum Seconds_Behind_Master of the replicas, a stopped replication counts as infinite lag
+func (c *change) replicaLag(ctx context.Context) (time.Duration, error) {
+	var max time.Duration
+	for _, replica := range c.opts.Replicas {
+		rows, err := replica.QueryContext(ctx, "SHOW SLAVE STATUS")
+		if err != nil {
+			return 0, err
+		}
+		lag, err := scanSecondsBehindMaster(rows)
+		rows.Close()
+		if err != nil {
+			return 0, err
+		}
+		if lag > max {
+			max = lag
+		}
+	}
+	return max, nil
+}
+
+func scanSecondsBehindMaster(rows *sql.Rows) (time.Duration, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if !rows.Next() {
+		return 0, errors.New("replication is not configured on the replica")
+	}
+
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return 0, err
+	}
+
+	for i, column := range columns {
+		if column != "Seconds_Behind_Master" {
+			continue
+		}
+		if values[i] == nil {
+			return time.Duration(1<<63 - 1), nil
+		}
+		seconds, err := strconv.ParseInt(string(values[i]), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return 0, errors.New("Seconds_Behind_Master column not found")
+}
+
+func (c *change) swap(ctx context.Context) error {
+	log.Printf("online schema: swapping %s and %s", c.opts.Table, c.shadow)
+	_, err := c.db.ExecContext(ctx, c.renameStatement())
+	if err != nil {
+		return err
+	}
+
+	// the triggers moved with the original table, nothing writes to it any more
+	c.dropTriggers()
+	if !c.opts.KeepOldTable {
+		_, err = c.db.Exec("DROP TABLE `" + c.old + "`")
+		if err != nil {
+			log.Printf("online schema: drop %s error: %s", c.old, err.Error())
+		}
+	}
+	return nil
+}
+
+// renameStatement swaps the tables atomically, no query sees the table missing
+func (c *change) renameStatement() string {
+	return fmt.Sprintf("RENAME TABLE `%s` TO `%s`, `%s` TO `%s`", c.opts.Table, c.old, c.shadow, c.opts.Table)
+}
+
+func (c *change) dropTriggers() {
+	for _, name := range c.triggers {
+		_, err := c.db.Exec("DROP TRIGGER IF EXISTS `" + name + "`")
+		if err != nil {
+			log.Printf("online schema: drop trigger %s error: %s", name, err.Error())
+		}
+	}
+	c.triggers = nil
+}
+
+// cleanup removes the triggers and the shadow table, it ignores the context to run after cancellation too
+func (c *change) cleanup() {
+	c.dropTriggers()
+	_, err := c.db.Exec("DROP TABLE IF EXISTS `" + c.shadow + "`")
+	if err != nil {
+		log.Printf("online schema: drop %s error: %s", c.shadow, err.Error())
+	}
+}
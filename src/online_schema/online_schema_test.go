@@ -0,0 +1,159 @@
+package online_schema
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testChange() *change {
+	c := planChange(nil, Options{Table: "users", ChunkSize: 100})
+	c.pk = "id"
+	c.columns = []string{"id", "login", "name"}
+	return c
+}
+
+func TestParseAlter(t *testing.T) {
+	tests := []struct {
+		statement string
+		table     string
+		alter     string
+		ok        bool
+	}{
+		{"ALTER TABLE users ADD age int", "users", "ADD age int", true},
+		{"alter table `users` add index (name);\n", "users", "add index (name)", true},
+		{"  ALTER TABLE users\n  ADD a int,\n  ADD b int ;  ", "users", "ADD a int,\n  ADD b int", true},
+		{"ALTER TABLE users ADD a int; DROP TABLE users", "", "", false},
+		{"CREATE INDEX name ON users (name)", "", "", false},
+		{"ALTER TABLE users", "", "", false},
+	}
+	for _, tt := range tests {
+		table, alter, err := ParseAlter(tt.statement)
+		if (err == nil) != tt.ok || table != tt.table || alter != tt.alter {
+			t.Errorf("ParseAlter(%q) = %q, %q, %v, want %q, %q, ok %v", tt.statement, table, alter, err, tt.table, tt.alter, tt.ok)
+		}
+	}
+}
+
+func TestPlanChange(t *testing.T) {
+	c := planChange(nil, Options{Table: "users"})
+	if c.shadow != "_users_new" || c.old != "_users_old" {
+		t.Errorf("planChange() tables = %q, %q, want %q, %q", c.shadow, c.old, "_users_new", "_users_old")
+	}
+	if c.opts.ChunkSize != 1000 {
+		t.Errorf("planChange() ChunkSize = %d, want 1000", c.opts.ChunkSize)
+	}
+}
+
+func TestCopiedColumns(t *testing.T) {
+	tests := []struct {
+		oldColumns []string
+		newColumns []string
+		want       []string
+		ok         bool
+	}{
+		// an added column gets its default, it is not copied
+		{[]string{"id", "login", "name"}, []string{"id", "login", "name", "age"}, []string{"id", "login", "name"}, true},
+		{[]string{"id", "login", "name"}, []string{"id", "name"}, []string{"id", "name"}, true},
+		// the order of the original table is kept even if the ALTER moved a column
+		{[]string{"id", "login", "name"}, []string{"name", "id", "login"}, []string{"id", "login", "name"}, true},
+		{[]string{"id", "login"}, []string{"uid", "login"}, nil, false},
+	}
+	for _, tt := range tests {
+		got, err := copiedColumns(tt.oldColumns, tt.newColumns, "id")
+		if (err == nil) != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("copiedColumns(%q, %q) = %q, %v, want %q, ok %v", tt.oldColumns, tt.newColumns, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestTriggerStatements(t *testing.T) {
+	replace := "REPLACE INTO `_users_new` (`id`, `login`, `name`) VALUES (NEW.`id`, NEW.`login`, NEW.`name`)"
+	want := []trigger{
+		{"_users_osc_ins", "CREATE TRIGGER `_users_osc_ins` AFTER INSERT ON `users` FOR EACH ROW " + replace},
+		// a changed primary key leaves no row under the old key in the shadow table
+		{"_users_osc_upd", "CREATE TRIGGER `_users_osc_upd` AFTER UPDATE ON `users` FOR EACH ROW BEGIN " +
+			"DELETE FROM `_users_new` WHERE `id` = OLD.`id` AND OLD.`id` <> NEW.`id`; " + replace + "; END"},
+		{"_users_osc_del", "CREATE TRIGGER `_users_osc_del` AFTER DELETE ON `users` FOR EACH ROW " +
+			"DELETE FROM `_users_new` WHERE `id` = OLD.`id`"},
+	}
+	got := testChange().triggerStatements()
+	if len(got) != len(want) {
+		t.Fatalf("triggerStatements() = %d triggers, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("triggerStatements()[%d] =\n%+v\nwant\n%+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestChunkQuery(t *testing.T) {
+	want := "INSERT IGNORE INTO `_users_new` (`id`, `login`, `name`) SELECT `id`, `login`, `name` FROM `users` " +
+		"WHERE `id` >= ? AND `id` < ? LOCK IN SHARE MODE"
+	if got := testChange().chunkQuery(); got != want {
+		t.Errorf("chunkQuery() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRenameStatement(t *testing.T) {
+	want := "RENAME TABLE `users` TO `_users_old`, `_users_new` TO `users`"
+	if got := testChange().renameStatement(); got != want {
+		t.Errorf("renameStatement() = %q, want %q", got, want)
+	}
+}
+
+func TestChunks(t *testing.T) {
+	tests := []struct {
+		minID int64
+		maxID int64
+		want  int64
+	}{
+		{0, 0, 0},
+		{1, 1, 1},
+		{1, 100, 1},
+		{1, 101, 2},
+		{1, 1000, 10},
+		// the chunks cover the key range, gaps included
+		{500, 1000, 6},
+	}
+	for _, tt := range tests {
+		c := testChange()
+		c.minID, c.maxID = tt.minID, tt.maxID
+		if got := c.chunks(); got != tt.want {
+			t.Errorf("chunks(%d..%d) = %d, want %d", tt.minID, tt.maxID, got, tt.want)
+		}
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxID        int64
+		chunkTime    time.Duration
+		pause        time.Duration
+		sampleChunks int64
+		want         Estimate
+	}{
+		{"sample", 1000, 50 * time.Millisecond, 0, 5,
+			Estimate{Rows: 900, SampledRows: 450, Chunks: 10, ChunkTime: 10 * time.Millisecond, Duration: 100 * time.Millisecond}},
+		{"pause", 1000, 50 * time.Millisecond, 20 * time.Millisecond, 5,
+			Estimate{Rows: 900, SampledRows: 450, Chunks: 10, ChunkTime: 10 * time.Millisecond, Duration: 300 * time.Millisecond}},
+		// a table smaller than the sample is copied completely
+		{"small table", 200, 30 * time.Millisecond, 0, 5,
+			Estimate{Rows: 900, SampledRows: 450, Chunks: 2, ChunkTime: 15 * time.Millisecond, Duration: 30 * time.Millisecond}},
+		{"no limit", 1000, 50 * time.Millisecond, 0, 0,
+			Estimate{Rows: 900, SampledRows: 450, Chunks: 10, ChunkTime: 5 * time.Millisecond, Duration: 50 * time.Millisecond}},
+		{"empty table", 0, 0, time.Second, 5,
+			Estimate{Rows: 900, SampledRows: 450}},
+	}
+	for _, tt := range tests {
+		c := testChange()
+		c.opts.ChunkPause = tt.pause
+		c.minID, c.maxID = 1, tt.maxID
+		c.chunkTime = tt.chunkTime
+		if got := c.estimate(900, 450, tt.sampleChunks); *got != tt.want {
+			t.Errorf("%s: estimate() = %+v, want %+v", tt.name, *got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package ratelimit
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// AdaptiveOptions of the concurrency limiter: the limit of in-flight requests moves between Min and Max,
+// it is cut when the average wait for a database connection exceeds TargetWait and grows back otherwise
+type AdaptiveOptions struct {
+	Min        int
+	Max        int
+	TargetWait time.Duration
+	Interval   time.Duration
+}
+
+// AdaptiveLimiter sheds requests above the concurrency limit instead of queueing them on the connection pool.
+// The limit is adjusted additive increase / multiplicative decrease by the pool wait time.
+type AdaptiveLimiter struct {
+	mu       sync.Mutex
+	opts     AdaptiveOptions
+	limit    float64
+	inFlight int
+	// the pool counters of the previous adjustment
+	waitCount    int64
+	waitDuration time.Duration
+}
+
+const decreaseFactor = 0.9
+
+func NewAdaptiveLimiter(opts AdaptiveOptions) *AdaptiveLimiter {
+	return &AdaptiveLimiter{opts: opts, limit: float64(opts.Max)}
+}
+
+// Acquire takes a slot, false means the request has to be shed. Every acquired slot is released.
+func (l *AdaptiveLimiter) Acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if float64(l.inFlight) >= l.limit {
+		return false
+	}
+	l.inFlight++
+	return true
+}
+
+func (l *AdaptiveLimiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+}
+
+func (l *AdaptiveLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+func (l *AdaptiveLimiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// Adjust moves the limit by the pool stats, the wait is averaged over the connections waited for since the last call
+func (l *AdaptiveLimiter) Adjust(stats sql.DBStats) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	waits := stats.WaitCount - l.waitCount
+	var avgWait time.Duration
+	if waits > 0 {
+		avgWait = (stats.WaitDuration - l.waitDuration) / time.Duration(waits)
+	}
+	l.waitCount = stats.WaitCount
+	l.waitDuration = stats.WaitDuration
+
+	if avgWait > l.opts.TargetWait {
+		// start from the current load: a limit far above it would not shed anything
+		current := float64(l.inFlight)
+		if current > l.limit {
+			current = l.limit
+		}
+		l.limit = current * decreaseFactor
+	} else {
+		l.limit++
+	}
+	if l.limit < float64(l.opts.Min) {
+		l.limit = float64(l.opts.Min)
+	}
+	if l.limit > float64(l.opts.Max) {
+		l.limit = float64(l.opts.Max)
+	}
+}
+
+// Run adjusts the limit by the stats of db every interval until stop is closed
+func (l *AdaptiveLimiter) Run(db *sql.DB, stop <-chan struct{}) {
+	stats := db.Stats()
+	l.mu.Lock()
+	l.waitCount, l.waitDuration = stats.WaitCount, stats.WaitDuration
+	l.mu.Unlock()
+
+	ticker := time.NewTicker(l.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			l.Adjust(db.Stats())
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Rate is a token bucket: PerSecond tokens are added every second up to Burst
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+// Enabled is false for the zero rate, it means no limit
+func (r Rate) Enabled() bool {
+	return r.PerSecond > 0 && r.Burst > 0
+}
+
+// Limiter keeps a token bucket per key (client ip, user id) in memory, the limits are per instance
+type Limiter struct {
+	mu      sync.Mutex
+	rate    Rate
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewLimiter(rate Rate) *Limiter {
+	return &Limiter{rate: rate, buckets: make(map[string]*bucket), now: time.Now}
+}
+
+// Allow takes a token of the key. If there is none it returns false and the time until the next one.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.rate.Burst), last: now}
+		l.buckets[key] = b
+	} else {
+		b.tokens = l.refill(b, now)
+		b.last = now
+	}
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate.PerSecond * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+func (l *Limiter) refill(b *bucket, now time.Time) float64 {
+	tokens := b.tokens + now.Sub(b.last).Seconds()*l.rate.PerSecond
+	if tokens > float64(l.rate.Burst) {
+		tokens = float64(l.rate.Burst)
+	}
+	return tokens
+}
+
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// Cleanup drops the full buckets, they are the same as new ones
+func (l *Limiter) Cleanup() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= float64(l.rate.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RunCleanup calls Cleanup every interval until stop is closed
+func (l *Limiter) RunCleanup(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			l.Cleanup()
+		}
+	}
+}
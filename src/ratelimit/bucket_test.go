@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	rate := Rate{PerSecond: 2, Burst: 3}
+	tests := []struct {
+		name string
+		// calls are the delays before each Allow of the key
+		calls []time.Duration
+		ok    bool
+		wait  time.Duration
+	}{
+		{"burst available", []time.Duration{0}, true, 0},
+		{"burst spent", []time.Duration{0, 0, 0}, true, 0},
+		{"over the burst", []time.Duration{0, 0, 0, 0}, false, 500 * time.Millisecond},
+		{"half a token refilled", []time.Duration{0, 0, 0, 250 * time.Millisecond}, false, 250 * time.Millisecond},
+		{"token refilled", []time.Duration{0, 0, 0, 500 * time.Millisecond}, true, 0},
+		{"refill capped by the burst", []time.Duration{0, 0, 0, time.Hour, 0, 0}, true, 0},
+		{"refill capped, burst spent again", []time.Duration{0, 0, 0, time.Hour, 0, 0, 0}, false, 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(0, 0)
+			l := NewLimiter(rate)
+			l.now = func() time.Time { return now }
+
+			var ok bool
+			var wait time.Duration
+			for _, delay := range tt.calls {
+				now = now.Add(delay)
+				ok, wait = l.Allow("key")
+			}
+			if ok != tt.ok || wait != tt.wait {
+				t.Errorf("Allow() = %v, %s, want %v, %s", ok, wait, tt.ok, tt.wait)
+			}
+		})
+	}
+}
+
+func TestLimiterKeysAndCleanup(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewLimiter(Rate{PerSecond: 1, Burst: 1})
+	l.now = func() time.Time { return now }
+
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("a: first request rejected")
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Fatal("b: rejected after a spent its bucket")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Fatal("a: allowed over the burst")
+	}
+
+	now = now.Add(time.Second)
+	l.Cleanup()
+	if n := l.Len(); n != 0 {
+		t.Errorf("Len() after the buckets refilled = %d, want 0", n)
+	}
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"strings"
+)
+
+type IAdminRepository interface {
+	// FindUsers returns the users with id after afterID which login, name, last name or email starts with query,
+	// all users if query is empty
+	FindUsers(ctx context.Context, query string, limit int, afterID int64) ([]*User, error)
+	// SetRole changes the role of the user
+	SetRole(ctx context.Context, userID int64, role string) error
+	// SetBlocked blocks or unblocks the user. Blocking increments the session version, the sessions are signed out.
+	SetBlocked(ctx context.Context, userID int64, blocked bool) error
+	// IncrementSessionVersion signs out all sessions of the user
+	IncrementSessionVersion(ctx context.Context, userID int64) error
+}
+
+// likePrefix escapes the wildcards of s for a LIKE pattern matching the strings starting with s
+func likePrefix(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s) + "%"
+}
+
+// FindUsers walks the primary key from afterID. The search is a union of prefix lookups, one per column, so each
+// one is a range scan of the index of its column instead of a full scan for an OR of the columns.
+func (r *repo) FindUsers(ctx context.Context, query string, limit int, afterID int64) ([]*User, error) {
+	const (
+		columns  = "SELECT id, login, name, last_name, email, role, blocked_at, created_at FROM users "
+		allQuery = columns + "WHERE id > ? ORDER BY id LIMIT ?"
+		// every branch is limited too: the page is the first limit ids of the union
+		searchQuery = "(" + columns + "WHERE login LIKE ? AND id > ? ORDER BY id LIMIT ?) " +
+			"UNION (" + columns + "WHERE name LIKE ? AND id > ? ORDER BY id LIMIT ?) " +
+			"UNION (" + columns + "WHERE last_name LIKE ? AND id > ? ORDER BY id LIMIT ?) " +
+			"UNION (" + columns + "WHERE email LIKE ? AND id > ? ORDER BY id LIMIT ?) " +
+			"ORDER BY id LIMIT ?"
+	)
+	q, args := allQuery, []interface{}{afterID, limit}
+	if len(query) > 0 {
+		pattern := likePrefix(query)
+		q, args = searchQuery, []interface{}{
+			likePrefix(NormalizeLogin(query)), afterID, limit,
+			pattern, afterID, limit,
+			pattern, afterID, limit,
+			pattern, afterID, limit,
+			limit,
+		}
+	}
+	ctx, span := startSpan(ctx, "FindUsers", q)
+	defer span.End()
+
+	rows, err := r.query(ctx, q, args...)
+	if err != nil {
+		return nil, spanError(span, wrapError("FindUsers", err))
+	}
+	defer rows.Close()
+
+	users := make([]*User, 0, limit)
+	for rows.Next() {
+		user := new(User)
+		err := rows.Scan(&user.ID, &user.Login, &user.Name, &user.LastName, &user.Email, &user.Role, &user.BlockedAt,
+			&user.CreatedAt)
+		if err != nil {
+			return nil, spanError(span, wrapError("FindUsers", err))
+		}
+		users = append(users, user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, spanError(span, wrapError("FindUsers", err))
+	}
+
+	span.SetAttribute("db.rows", len(users))
+	return users, nil
+}
+
+func (r *repo) SetRole(ctx context.Context, userID int64, role string) error {
+	const query = "UPDATE users SET role = ? WHERE id = ?"
+	ctx, span := startSpan(ctx, "SetRole", query)
+	defer span.End()
+
+	res, err := r.exec(ctx, query, role, userID)
+	if err != nil {
+		return spanError(span, wrapError("SetRole", err))
+	}
+	setRowsAffected(span, res)
+	return nil
+}
+
+func (r *repo) SetBlocked(ctx context.Context, userID int64, blocked bool) error {
+	const (
+		blockQuery   = "UPDATE users SET blocked_at = UTC_TIMESTAMP(), session_version = session_version + 1 WHERE id = ?"
+		unblockQuery = "UPDATE users SET blocked_at = NULL WHERE id = ?"
+	)
+	query := unblockQuery
+	if blocked {
+		query = blockQuery
+	}
+	ctx, span := startSpan(ctx, "SetBlocked", query)
+	defer span.End()
+
+	res, err := r.exec(ctx, query, userID)
+	if err != nil {
+		return spanError(span, wrapError("SetBlocked", err))
+	}
+	setRowsAffected(span, res)
+	return nil
+}
+
+func (r *repo) IncrementSessionVersion(ctx context.Context, userID int64) error {
+	const query = "UPDATE users SET session_version = session_version + 1 WHERE id = ?"
+	ctx, span := startSpan(ctx, "IncrementSessionVersion", query)
+	defer span.End()
+
+	res, err := r.exec(ctx, query, userID)
+	if err != nil {
+		return spanError(span, wrapError("IncrementSessionVersion", err))
+	}
+	setRowsAffected(span, res)
+	return nil
+}
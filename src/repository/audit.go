@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+// audit actions
+const (
+	AuditLoginFailed = "login.failed"
+	AuditLoginLocked = "login.locked"
+	// AuditLoginBlocked is a correct password of a blocked user
+	AuditLoginBlocked = "login.blocked"
+
+	AuditPasswordChanged        = "password.changed"
+	AuditPasswordResetRequested = "password.reset_requested"
+	AuditPasswordReset          = "password.reset"
+
+	AuditSessionRevoked       = "session.revoked"
+	AuditSessionsRevokedOther = "session.revoked_other"
+
+	AuditTwoFactorEnabled      = "2fa.enabled"
+	AuditTwoFactorDisabled     = "2fa.disabled"
+	AuditTwoFactorFailed       = "2fa.failed"
+	AuditTwoFactorRecoveryUsed = "2fa.recovery_code_used"
+
+	AuditAdminUserViewed      = "admin.user_viewed"
+	AuditAdminUserBlocked     = "admin.user_blocked"
+	AuditAdminUserUnblocked   = "admin.user_unblocked"
+	AuditAdminSessionsRevoked = "admin.sessions_revoked"
+	AuditAdminRoleChanged     = "admin.role_changed"
+)
+
+// AuditEntry is a security relevant event: UserID is the affected user if known, Login is the login as entered.
+// ActorID is the user who made the change if it is not the affected one, e.g. an administrator.
+type AuditEntry struct {
+	ID        int64
+	Action    string
+	UserID    sql.NullInt64
+	ActorID   sql.NullInt64
+	Login     string
+	IP        string
+	Details   string
+	CreatedAt sql.NullTime
+}
+
+type IAuditRepository interface {
+	AddAuditEntry(ctx context.Context, entry *AuditEntry) error
+	// GetUserAuditEntries returns the last limit entries of the affected user, the newest first
+	GetUserAuditEntries(ctx context.Context, userID int64, limit int) ([]*AuditEntry, error)
+}
+
+func (r *repo) AddAuditEntry(ctx context.Context, entry *AuditEntry) error {
+	const query = "INSERT INTO audit_log(action, user_id, actor_id, login, ip, details, created_at) VALUES(?, ?, ?, ?, ?, ?, NOW())"
+	ctx, span := startSpan(ctx, "AddAuditEntry", query)
+	defer span.End()
+
+	res, err := r.exec(ctx, query, entry.Action, entry.UserID, entry.ActorID, truncate(entry.Login, 255), entry.IP,
+		truncate(entry.Details, 1000))
+	if err != nil {
+		return spanError(span, wrapError("AddAuditEntry", err))
+	}
+	if entry.ID, err = res.LastInsertId(); err != nil {
+		return spanError(span, wrapError("AddAuditEntry", err))
+	}
+	setRowsAffected(span, res)
+	return nil
+}
+
+func (r *repo) GetUserAuditEntries(ctx context.Context, userID int64, limit int) ([]*AuditEntry, error) {
+	const query = "SELECT id, action, user_id, actor_id, login, ip, details, created_at FROM audit_log " +
+		"WHERE user_id = ? ORDER BY created_at DESC, id DESC LIMIT ?"
+	ctx, span := startSpan(ctx, "GetUserAuditEntries", query)
+	defer span.End()
+
+	rows, err := r.query(ctx, query, userID, limit)
+	if err != nil {
+		return nil, spanError(span, wrapError("GetUserAuditEntries", err))
+	}
+	defer rows.Close()
+
+	entries := make([]*AuditEntry, 0, limit)
+	for rows.Next() {
+		entry := new(AuditEntry)
+		err := rows.Scan(&entry.ID, &entry.Action, &entry.UserID, &entry.ActorID, &entry.Login, &entry.IP, &entry.Details,
+			&entry.CreatedAt)
+		if err != nil {
+			return nil, spanError(span, wrapError("GetUserAuditEntries", err))
+		}
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, spanError(span, wrapError("GetUserAuditEntries", err))
+	}
+
+	span.SetAttribute("db.rows", len(entries))
+	return entries, nil
+}
+
+// truncate cuts s to n runes, the audit keeps whatever the client sent
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
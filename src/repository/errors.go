@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/crypto/bcrypt"
+	"net"
+)
+
+var (
+	// ErrNotFound - the requested entity does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrConflict - the entity violates a uniqueness constraint
+	ErrConflict = errors.New("conflict")
+	// ErrInvalidCredentials - login/password pair does not match any user
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrUnavailable - the database can not be reached right now, the request may be retried later
+	ErrUnavailable = errors.New("unavailable")
+)
+
+const (
+	mysqlErrDuplicateEntry = 1062
+	mysqlErrNoSuchTable    = 1146
+)
+
+func isMysqlError(err error, number uint16) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == number
+}
+
+// Error wraps a low level error with the repository operation and its kind (one of the Err* values above).
+// The wrapped error is kept for logging only and must not be shown to the user.
+type Error struct {
+	Kind error
+	Op   string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Op + ": " + e.Kind.Error()
+	}
+	return fmt.Sprintf("%s: %s: %s", e.Op, e.Kind.Error(), e.Err.Error())
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return e.Kind == target
+}
+
+// wrapError classifies err returned by the sql driver. Errors of unknown kind are returned as is.
+func wrapError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var kind error
+	var netErr net.Error
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		kind = ErrNotFound
+	case isMysqlError(err, mysqlErrDuplicateEntry):
+		kind = ErrConflict
+	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		kind = ErrInvalidCredentials
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, mysql.ErrInvalidConn),
+		errors.Is(err, sql.ErrConnDone), errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr):
+		kind = ErrUnavailable
+	default:
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Error{Kind: kind, Op: op, Err: err}
+}
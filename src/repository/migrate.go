@@ -1,51 +1,97 @@
 package repository
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/mysql"
+	"github.com/golang-migrate/migrate/v4/source"
 	"github.com/golang-migrate/migrate/v4/source/file"
 	"log"
+	"os"
 	"strconv"
+	"strings"
 )
 
-func Migrate(connUri string, migrationsDir string) error {
-	log.Print("Migration started")
+// preflightChecks are run before applying the migration with the given version.
+// They reject data the migration can not handle, so it fails with a readable report
+// instead of leaving the schema dirty halfway through.
+var preflightChecks = map[uint]func(db *sql.DB) error{
+	20191105120000: checkDuplicateLogins,
+}
+
+// Migrator applies migrations from the migrations dir to the database in both directions
+type Migrator struct {
+	m       *migrate.Migrate
+	source  source.Driver
+	connUri string
+}
+
+// MigrationStatus describes the schema version of the database
+type MigrationStatus struct {
+	// Version is the last applied migration, 0 if none was applied
+	Version uint
+	// Dirty is set when the migration Version failed halfway, the schema must be fixed by hand and the version forced
+	Dirty bool
+	// Pending are migrations not applied yet in the order of applying
+	Pending []uint
+	// Latest is the version of the last migration in the migrations dir
+	Latest uint
+}
+
+type migrateLogger struct{}
 
+func (migrateLogger) Printf(format string, v ...interface{}) {
+	log.Printf("Migration: "+strings.TrimSuffix(format, "\n"), v...)
+}
+
+func (migrateLogger) Verbose() bool {
+	return false
+}
+
+func NewMigrator(connUri string, migrationsDir string) (*Migrator, error) {
 	fileSource, err := (&file.File{}).Open("file://" + migrationsDir)
 	if err != nil {
 		log.Printf("Migration file open failed: %s", err.Error())
-		return err
+		return nil, err
 	}
 	log.Print("Opened migration store")
 
-	log.Print("create NewSourceWithInstance")
 	m, err := migrate.NewWithSourceInstance("file", fileSource, connUri)
 	if err != nil {
 		log.Printf("NewWithSourceInstance creation failed: %s", err.Error())
-		return err
+		return nil, err
 	}
+	m.Log = migrateLogger{}
 	log.Print("Migrator initialized")
 
-	version, dirty, err := m.Version()
+	return &Migrator{m: m, source: fileSource, connUri: connUri}, nil
+}
+
+// Migrate applies all pending migrations, it is used by the server when MIGRATE_ON_START is set
+func Migrate(connUri string, migrationsDir string) error {
+	log.Print("Migration started")
+
+	m, err := NewMigrator(connUri, migrationsDir)
 	if err != nil {
-		log.Print("No current migration version found")
+		return err
 	}
+	defer m.Close()
 
-	log.Print("Migrating: current schema version ",
-		strconv.FormatInt(int64(version), 10),
-		" dirty: ", strconv.FormatBool(dirty))
-	err = m.Up()
-	if err != nil {
-		if err == migrate.ErrNoChange {
-			log.Print("Migration: already up to date (no change)")
-		} else {
-			log.Printf("Migration: ERROR %s", err.Error())
-			return err
-		}
+	err = m.Up(0)
+	if err != nil {
+		return err
 	}
 
 	log.Print("Migration: SUCCESS")
-	srcErr, dbErr := m.Close()
+	return nil
+}
+
+// Close releases the migrations source and the database connection
+func (m *Migrator) Close() {
+	srcErr, dbErr := m.m.Close()
 
 	if srcErr != nil {
 		log.Printf("Migration: ERROR while closing source - %v", srcErr.Error())
@@ -54,6 +100,234 @@ func Migrate(connUri string, migrationsDir string) error {
 	if dbErr != nil {
 		log.Printf("Migration: ERROR while closing database - %v", dbErr.Error())
 	}
+}
+
+// Status returns the current schema version and the list of pending migrations
+func (m *Migrator) Status() (*MigrationStatus, error) {
+	status := new(MigrationStatus)
+
+	version, dirty, err := m.m.Version()
+	if err != nil && err != migrate.ErrNilVersion {
+		return nil, err
+	}
+	status.Version = version
+	status.Dirty = dirty
+
+	versions, err := m.versions()
+	if err != nil {
+		return nil, err
+	}
+	status.Pending = make([]uint, 0)
+	for _, v := range versions {
+		if v > version {
+			status.Pending = append(status.Pending, v)
+		}
+	}
+	if len(versions) > 0 {
+		status.Latest = versions[len(versions)-1]
+	}
+
+	return status, nil
+}
+
+// Up applies the next steps migrations, all pending ones if steps <= 0
+func (m *Migrator) Up(steps int) error {
+	status, err := m.Status()
+	if err != nil {
+		return err
+	}
+	m.logStatus(status)
+
+	target := status.Latest
+	if steps > 0 && steps < len(status.Pending) {
+		target = status.Pending[steps-1]
+	}
+	err = m.runPreflightChecks(status.Version, target)
+	if err != nil {
+		return err
+	}
+
+	if steps > 0 {
+		err = m.m.Steps(steps)
+	} else {
+		err = m.m.Up()
+	}
+	return m.result(err)
+}
+
+// Down reverts the last steps migrations
+func (m *Migrator) Down(steps int) error {
+	if steps <= 0 {
+		return fmt.Errorf("invalid number of steps: %d", steps)
+	}
+
+	status, err := m.Status()
+	if err != nil {
+		return err
+	}
+	m.logStatus(status)
+
+	return m.result(m.m.Steps(-steps))
+}
+
+// Goto migrates up or down to the given version
+func (m *Migrator) Goto(version uint) error {
+	status, err := m.Status()
+	if err != nil {
+		return err
+	}
+	m.logStatus(status)
 
+	err = m.runPreflightChecks(status.Version, version)
+	if err != nil {
+		return err
+	}
+
+	return m.result(m.m.Migrate(version))
+}
+
+// Force sets the schema version and clears the dirty flag without running any migration.
+// It is used to recover after a failed migration was fixed by hand, -1 means no version.
+func (m *Migrator) Force(version int) error {
+	err := m.m.Force(version)
+	if err != nil {
+		log.Printf("Migration: ERROR %s", err.Error())
+		return err
+	}
+	log.Printf("Migration: version forced to %d", version)
+	return nil
+}
+
+func (m *Migrator) logStatus(status *MigrationStatus) {
+	log.Print("Migrating: current schema version ",
+		strconv.FormatInt(int64(status.Version), 10),
+		" dirty: ", strconv.FormatBool(status.Dirty))
+}
+
+func (m *Migrator) result(err error) error {
+	if err == migrate.ErrNoChange {
+		log.Print("Migration: already up to date (no change)")
+		return nil
+	}
+	var dirtyErr migrate.ErrDirty
+	if errors.As(err, &dirtyErr) {
+		log.Printf("Migration: ERROR schema is dirty at version %d, fix it by hand and use force", dirtyErr.Version)
+		return err
+	}
+	if err != nil {
+		log.Printf("Migration: ERROR %s", err.Error())
+		return err
+	}
+	return nil
+}
+
+// versions lists all migrations of the migrations dir in ascending order
+func (m *Migrator) versions() ([]uint, error) {
+	return sourceVersions(m.source)
+}
+
+func sourceVersions(src source.Driver) ([]uint, error) {
+	versions := make([]uint, 0)
+	version, err := src.First()
+	for err == nil {
+		versions = append(versions, version)
+		version, err = src.Next(version)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// NewSchemaVersionCheck returns the readiness check comparing the schema version of the database
+// with the last migration of the migrations dir, the server must not serve an outdated or dirty schema
+func NewSchemaVersionCheck(db *sql.DB, migrationsDir string) (func(ctx context.Context) error, error) {
+	fileSource, err := (&file.File{}).Open("file://" + migrationsDir)
+	if err != nil {
+		return nil, err
+	}
+	defer fileSource.Close()
+
+	versions, err := sourceVersions(fileSource)
+	if err != nil {
+		return nil, err
+	}
+	var expected uint
+	if len(versions) > 0 {
+		expected = versions[len(versions)-1]
+	}
+
+	return func(ctx context.Context) error {
+		var version uint
+		var dirty bool
+		err := db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("schema is dirty at version %d", version)
+		}
+		if version != expected {
+			return fmt.Errorf("schema version %d, expected %d", version, expected)
+		}
+		return nil
+	}, nil
+}
+
+// runPreflightChecks runs the checks of migrations applied on the way from one version up to another
+func (m *Migrator) runPreflightChecks(from uint, to uint) error {
+	var db *sql.DB
+	for version, check := range preflightChecks {
+		if version <= from || version > to {
+			continue
+		}
+		if db == nil {
+			var err error
+			db, err = openMysql(m.connUri)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+		}
+		err := check(db)
+		if err != nil {
+			log.Printf("Migration: preflight check failed: %s", err.Error())
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+	}
+	return nil
+}
+
+// checkDuplicateLogins reports logins which become equal after normalization and would break the unique index
+func checkDuplicateLogins(db *sql.DB) error {
+	rows, err := db.Query("SELECT LOWER(TRIM(login)) AS l, COUNT(*), GROUP_CONCAT(id ORDER BY id) FROM users " +
+		"GROUP BY l HAVING COUNT(*) > 1")
+	if isMysqlError(err, mysqlErrNoSuchTable) {
+		// fresh database, the table is created by the earlier migrations
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	duplicates := make([]string, 0)
+	for rows.Next() {
+		var login, ids string
+		var count int
+		err := rows.Scan(&login, &count, &ids)
+		if err != nil {
+			return err
+		}
+		log.Printf("duplicate login [%s]: %d users, ids %s", login, count, ids)
+		duplicates = append(duplicates, login)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if len(duplicates) > 0 {
+		return fmt.Errorf("%d duplicate logins must be resolved first: %s", len(duplicates), strings.Join(duplicates, ", "))
+	}
 	return nil
 }
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"github.com/golang-migrate/migrate/v4"
+	"io/ioutil"
+	"log"
+	"otus-hiload/src/online_schema"
+)
+
+// UpOnline applies the next pending migration with the online schema change instead of a plain ALTER TABLE,
+// so large tables stay writable. The migration must consist of a single ALTER TABLE statement.
+// With dryRun the change is only estimated and the version is not recorded.
+func (m *Migrator) UpOnline(ctx context.Context, opts online_schema.Options, replicaUris []string, dryRun bool) error {
+	status, err := m.Status()
+	if err != nil {
+		return err
+	}
+	m.logStatus(status)
+	if status.Dirty {
+		log.Printf("Migration: ERROR schema is dirty at version %d, fix it by hand and use force", status.Version)
+		return migrate.ErrDirty{Version: int(status.Version)}
+	}
+	if len(status.Pending) == 0 {
+		log.Print("Migration: already up to date (no change)")
+		return nil
+	}
+
+	version := status.Pending[0]
+	statement, err := m.readUp(version)
+	if err != nil {
+		return err
+	}
+	opts.Table, opts.Alter, err = online_schema.ParseAlter(statement)
+	if err != nil {
+		log.Printf("Migration: ERROR %d: %s", version, err.Error())
+		return err
+	}
+
+	err = m.runPreflightChecks(status.Version, version)
+	if err != nil {
+		return err
+	}
+
+	db, err := openMysql(m.connUri)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for _, uri := range replicaUris {
+		replica, err := openMysql(uri)
+		if err != nil {
+			return err
+		}
+		defer replica.Close()
+		opts.Replicas = append(opts.Replicas, replica)
+	}
+
+	if dryRun {
+		estimate, err := online_schema.DryRun(ctx, db, opts, 10)
+		if err != nil {
+			log.Printf("Migration: ERROR dry run %d: %s", version, err.Error())
+			return err
+		}
+		log.Printf("Migration: dry run %d on %s: %d rows in %d chunks, %s per chunk, estimated duration %s",
+			version, opts.Table, estimate.Rows, estimate.Chunks, estimate.ChunkTime, estimate.Duration)
+		return nil
+	}
+
+	log.Printf("Migration: applying %d online on %s", version, opts.Table)
+	err = online_schema.Run(ctx, db, opts)
+	if err != nil {
+		log.Printf("Migration: ERROR %d: %s", version, err.Error())
+		return err
+	}
+
+	return m.Force(int(version))
+}
+
+func (m *Migrator) readUp(version uint) (string, error) {
+	r, _, err := m.source.ReadUp(version)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
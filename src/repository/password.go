@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"golang.org/x/crypto/bcrypt"
+	"time"
+)
+
+type IPasswordRepository interface {
+	// UpdatePassword stores the hash of user.Password and increments user.SessionVersion
+	UpdatePassword(ctx context.Context, user *User) error
+	// CreatePasswordReset stores the sha256 of a reset token, the token expires after ttl
+	CreatePasswordReset(ctx context.Context, userID int64, tokenHash string, ttl time.Duration) error
+	// ResetPassword uses the unexpired reset of the token hash to set the password, all pending resets of the user
+	// are used up with it. It returns the id of the user, ErrNotFound if there is no such reset.
+	ResetPassword(ctx context.Context, tokenHash string, password string) (int64, error)
+}
+
+func hashPassword(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+}
+
+func (r *repo) UpdatePassword(ctx context.Context, user *User) error {
+	passwordHash, err := hashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+
+	const query = "UPDATE users SET password_hash = ?, session_version = session_version + 1 WHERE id = ?"
+	ctx, span := startSpan(ctx, "UpdatePassword", query)
+	defer span.End()
+
+	res, err := r.exec(ctx, query, passwordHash, user.ID)
+	if err != nil {
+		return spanError(span, wrapError("UpdatePassword", err))
+	}
+	user.SessionVersion++
+	setRowsAffected(span, res)
+	return nil
+}
+
+func (r *repo) CreatePasswordReset(ctx context.Context, userID int64, tokenHash string, ttl time.Duration) error {
+	// expiry is computed by the database, the same clock checks it
+	const query = "INSERT INTO password_resets(user_id, token_hash, created_at, expires_at) " +
+		"VALUES(?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP() + INTERVAL ? SECOND)"
+	ctx, span := startSpan(ctx, "CreatePasswordReset", query)
+	defer span.End()
+
+	res, err := r.exec(ctx, query, userID, tokenHash, int64(ttl/time.Second))
+	if err != nil {
+		return spanError(span, wrapError("CreatePasswordReset", err))
+	}
+	setRowsAffected(span, res)
+	return nil
+}
+
+// ResetPassword locks the reset row, so concurrent uses of one token can not both succeed
+func (r *repo) ResetPassword(ctx context.Context, tokenHash string, password string) (int64, error) {
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		return 0, err
+	}
+
+	const (
+		selectQuery = "SELECT user_id FROM password_resets WHERE token_hash = ? AND used_at IS NULL AND expires_at > UTC_TIMESTAMP() FOR UPDATE"
+		useQuery    = "UPDATE password_resets SET used_at = UTC_TIMESTAMP() WHERE user_id = ? AND used_at IS NULL"
+		updateQuery = "UPDATE users SET password_hash = ?, session_version = session_version + 1 WHERE id = ?"
+	)
+	ctx, span := startSpan(ctx, "ResetPassword", selectQuery)
+	defer span.End()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, spanError(span, wrapError("ResetPassword", err))
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	err = tx.QueryRowContext(ctx, selectQuery, tokenHash).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, spanError(span, &Error{Kind: ErrNotFound, Op: "ResetPassword", Err: err})
+	}
+	if err != nil {
+		return 0, spanError(span, wrapError("ResetPassword", err))
+	}
+	if _, err := tx.ExecContext(ctx, useQuery, userID); err != nil {
+		return 0, spanError(span, wrapError("ResetPassword", err))
+	}
+	if _, err := tx.ExecContext(ctx, updateQuery, passwordHash, userID); err != nil {
+		return 0, spanError(span, wrapError("ResetPassword", err))
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, spanError(span, wrapError("ResetPassword", err))
+	}
+	span.SetAttribute("db.rows", 1)
+	return userID, nil
+}
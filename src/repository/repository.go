@@ -1,25 +1,54 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
-	"log"
-	"strings"
+	"otus-hiload/src/tracing"
 )
 
 type repo struct {
 	db *sql.DB
+	// stmts is nil when statements are not prepared
+	stmts *stmtCache
 }
 
 type IRepository interface {
 	IUserRepository
+	IPasswordRepository
+	IAuditRepository
+	ISessionRepository
+	ITwoFactorRepository
+	IAdminRepository
 }
 
-func NewMysqlRepository(dsn string) IRepository {
-	dsn = strings.Replace(dsn, "mysql://", "", 1) + "?parseTime=true"
-	db, err := sql.Open("mysql", dsn)
+// NewMysqlRepository connects to the database of the connection uri, waiting for it up to opts.ConnectTimeout
+func NewMysqlRepository(ctx context.Context, connUri string, opts MysqlOptions) (IRepository, error) {
+	db, err := OpenMysql(ctx, connUri, opts)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	r := &repo{db: db}
+	if opts.PreparedStatements {
+		r.stmts = newStmtCache(db)
+	}
+	return r, nil
+}
+
+// startSpan starts the span of a repository query, the SQL text is recorded without arguments
+func startSpan(ctx context.Context, op string, query string) (context.Context, *tracing.Span) {
+	ctx, span := tracing.Start(ctx, "repository."+op)
+	span.SetAttribute("db.system", "mysql")
+	span.SetAttribute("db.statement", query)
+	return ctx, span
+}
+
+func spanError(span *tracing.Span, err error) error {
+	span.SetError(err)
+	return err
+}
+
+func setRowsAffected(span *tracing.Span, res sql.Result) {
+	if n, err := res.RowsAffected(); err == nil {
+		span.SetAttribute("db.rows", n)
 	}
-	db.SetConnMaxLifetime(0)
-	return &repo{db: db}
 }
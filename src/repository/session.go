@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// UserSession is the metadata of an authenticated session: ID is kept in the session data and survives token renewals,
+// Token is the current token of the session in the session store
+type UserSession struct {
+	ID         string
+	UserID     int64
+	Token      string
+	IP         string
+	UserAgent  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+}
+
+type ISessionRepository interface {
+	// SaveSession inserts the session or updates the token, expiry and client of an existing one,
+	// a revoked session stays revoked
+	SaveSession(ctx context.Context, session *UserSession) error
+	// TouchSession updates the last seen time and the client of the session, it returns false if the session
+	// is revoked, expired or unknown
+	TouchSession(ctx context.Context, id string, ip string, userAgent string) (bool, error)
+	// IsSessionActive returns false if the session is revoked, expired or unknown, it changes nothing
+	IsSessionActive(ctx context.Context, id string) (bool, error)
+	// GetUserSessions returns the active sessions of the user, the last seen first
+	GetUserSessions(ctx context.Context, userID int64) ([]*UserSession, error)
+	// RevokeSession revokes the active session of the user and returns its token, ErrNotFound if there is none
+	RevokeSession(ctx context.Context, userID int64, id string) (string, error)
+	// RevokeUserSessions revokes the active sessions of the user except the session exceptID and returns their tokens
+	RevokeUserSessions(ctx context.Context, userID int64, exceptID string) ([]string, error)
+	// DeleteExpiredSessions deletes the sessions expired before now
+	DeleteExpiredSessions(ctx context.Context) (int64, error)
+}
+
+func (r *repo) SaveSession(ctx context.Context, session *UserSession) error {
+	const query = "INSERT INTO user_sessions(id, user_id, token, ip, user_agent, created_at, last_seen_at, expires_at) " +
+		"VALUES(?, ?, ?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP(), ?) " +
+		"ON DUPLICATE KEY UPDATE token = VALUES(token), ip = VALUES(ip), user_agent = VALUES(user_agent), " +
+		"last_seen_at = VALUES(last_seen_at), expires_at = VALUES(expires_at)"
+	ctx, span := startSpan(ctx, "SaveSession", query)
+	defer span.End()
+
+	res, err := r.exec(ctx, query, session.ID, session.UserID, session.Token, session.IP, truncate(session.UserAgent, 255),
+		session.ExpiresAt.UTC())
+	if err != nil {
+		return spanError(span, wrapError("SaveSession", err))
+	}
+	setRowsAffected(span, res)
+	return nil
+}
+
+func (r *repo) TouchSession(ctx context.Context, id string, ip string, userAgent string) (bool, error) {
+	// last_seen_at changes on every touch, so a matched row is always an affected row
+	const query = "UPDATE user_sessions SET last_seen_at = UTC_TIMESTAMP(), ip = ?, user_agent = ? " +
+		"WHERE id = ? AND revoked_at IS NULL AND expires_at > UTC_TIMESTAMP()"
+	ctx, span := startSpan(ctx, "TouchSession", query)
+	defer span.End()
+
+	res, err := r.exec(ctx, query, ip, truncate(userAgent, 255), id)
+	if err != nil {
+		return false, spanError(span, wrapError("TouchSession", err))
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, spanError(span, wrapError("TouchSession", err))
+	}
+	span.SetAttribute("db.rows", n)
+	return n > 0, nil
+}
+
+func (r *repo) IsSessionActive(ctx context.Context, id string) (bool, error) {
+	const query = "SELECT 1 FROM user_sessions WHERE id = ? AND revoked_at IS NULL AND expires_at > UTC_TIMESTAMP()"
+	ctx, span := startSpan(ctx, "IsSessionActive", query)
+	defer span.End()
+
+	var one int
+	err := r.queryRow(ctx, query, []interface{}{id}, &one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, spanError(span, wrapError("IsSessionActive", err))
+	}
+	return true, nil
+}
+
+func (r *repo) GetUserSessions(ctx context.Context, userID int64) ([]*UserSession, error) {
+	const query = "SELECT id, user_id, token, ip, user_agent, created_at, last_seen_at, expires_at FROM user_sessions " +
+		"WHERE user_id = ? AND revoked_at IS NULL AND expires_at > UTC_TIMESTAMP() ORDER BY last_seen_at DESC"
+	ctx, span := startSpan(ctx, "GetUserSessions", query)
+	defer span.End()
+
+	rows, err := r.query(ctx, query, userID)
+	if err != nil {
+		return nil, spanError(span, wrapError("GetUserSessions", err))
+	}
+	defer rows.Close()
+
+	var sessions []*UserSession
+	for rows.Next() {
+		s := new(UserSession)
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Token, &s.IP, &s.UserAgent, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt); err != nil {
+			return nil, spanError(span, wrapError("GetUserSessions", err))
+		}
+		sessions = append(sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, spanError(span, wrapError("GetUserSessions", err))
+	}
+	span.SetAttribute("db.rows", len(sessions))
+	return sessions, nil
+}
+
+func (r *repo) RevokeSession(ctx context.Context, userID int64, id string) (string, error) {
+	const (
+		selectQuery = "SELECT token FROM user_sessions WHERE id = ? AND user_id = ? AND revoked_at IS NULL FOR UPDATE"
+		revokeQuery = "UPDATE user_sessions SET revoked_at = UTC_TIMESTAMP() WHERE id = ?"
+	)
+	ctx, span := startSpan(ctx, "RevokeSession", revokeQuery)
+	defer span.End()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", spanError(span, wrapError("RevokeSession", err))
+	}
+	defer tx.Rollback()
+
+	var token string
+	err = tx.QueryRowContext(ctx, selectQuery, id, userID).Scan(&token)
+	if err == sql.ErrNoRows {
+		return "", spanError(span, &Error{Kind: ErrNotFound, Op: "RevokeSession", Err: err})
+	}
+	if err != nil {
+		return "", spanError(span, wrapError("RevokeSession", err))
+	}
+	if _, err := tx.ExecContext(ctx, revokeQuery, id); err != nil {
+		return "", spanError(span, wrapError("RevokeSession", err))
+	}
+	if err := tx.Commit(); err != nil {
+		return "", spanError(span, wrapError("RevokeSession", err))
+	}
+	span.SetAttribute("db.rows", 1)
+	return token, nil
+}
+
+func (r *repo) RevokeUserSessions(ctx context.Context, userID int64, exceptID string) ([]string, error) {
+	const (
+		selectQuery = "SELECT token FROM user_sessions WHERE user_id = ? AND id <> ? AND revoked_at IS NULL FOR UPDATE"
+		revokeQuery = "UPDATE user_sessions SET revoked_at = UTC_TIMESTAMP() WHERE user_id = ? AND id <> ? AND revoked_at IS NULL"
+	)
+	ctx, span := startSpan(ctx, "RevokeUserSessions", revokeQuery)
+	defer span.End()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, spanError(span, wrapError("RevokeUserSessions", err))
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, selectQuery, userID, exceptID)
+	if err != nil {
+		return nil, spanError(span, wrapError("RevokeUserSessions", err))
+	}
+	var tokens []string
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			rows.Close()
+			return nil, spanError(span, wrapError("RevokeUserSessions", err))
+		}
+		tokens = append(tokens, token)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, spanError(span, wrapError("RevokeUserSessions", err))
+	}
+
+	res, err := tx.ExecContext(ctx, revokeQuery, userID, exceptID)
+	if err != nil {
+		return nil, spanError(span, wrapError("RevokeUserSessions", err))
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, spanError(span, wrapError("RevokeUserSessions", err))
+	}
+	setRowsAffected(span, res)
+	return tokens, nil
+}
+
+func (r *repo) DeleteExpiredSessions(ctx context.Context) (int64, error) {
+	const query = "DELETE FROM user_sessions WHERE expires_at < UTC_TIMESTAMP()"
+	ctx, span := startSpan(ctx, "DeleteExpiredSessions", query)
+	defer span.End()
+
+	res, err := r.exec(ctx, query)
+	if err != nil {
+		return 0, spanError(span, wrapError("DeleteExpiredSessions", err))
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, spanError(span, wrapError("DeleteExpiredSessions", err))
+	}
+	span.SetAttribute("db.rows", n)
+	return n, nil
+}
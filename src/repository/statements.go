@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+const (
+	// mysqlErrNeedReprepare is returned when the table of a prepared statement was altered
+	mysqlErrNeedReprepare = 1615
+	// mysqlErrUnknownStmtHandler is returned when the server lost the statement, e.g. after a restart behind a proxy
+	mysqlErrUnknownStmtHandler = 1243
+)
+
+// stmtCache prepares each query once per pool. database/sql re-prepares a statement on every new
+// connection it is used on, so connection loss is handled by the pool; statements the server
+// invalidated are dropped and prepared again.
+type stmtCache struct {
+	db    *sql.DB
+	mu    sync.RWMutex
+	stmts map[string]*sql.Stmt
+}
+
+func newStmtCache(db *sql.DB) *stmtCache {
+	return &stmtCache{db: db, stmts: make(map[string]*sql.Stmt)}
+}
+
+// get returns the cached statement. The lock is not held while preparing, so a slow prepare of one query
+// does not block the others; concurrent callers may prepare the same query and the loser closes its copy.
+func (c *stmtCache) get(ctx context.Context, query string) (*sql.Stmt, error) {
+	c.mu.RLock()
+	stmt, ok := c.stmts[query]
+	c.mu.RUnlock()
+	if ok {
+		return stmt, nil
+	}
+
+	stmt, err := c.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.stmts[query]; ok {
+		_ = stmt.Close()
+		return cached, nil
+	}
+	c.stmts[query] = stmt
+	return stmt, nil
+}
+
+// invalidate drops the statement unless it was already replaced by a concurrent caller
+func (c *stmtCache) invalidate(query string, stmt *sql.Stmt) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stmts[query] == stmt {
+		delete(c.stmts, query)
+		_ = stmt.Close()
+	}
+}
+
+func isStaleStatement(err error) bool {
+	return isMysqlError(err, mysqlErrNeedReprepare) || isMysqlError(err, mysqlErrUnknownStmtHandler)
+}
+
+// query runs the query through the cached statement if statements are prepared, otherwise sends the text
+func (r *repo) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if r.stmts == nil {
+		return r.db.QueryContext(ctx, query, args...)
+	}
+	for attempt := 0; ; attempt++ {
+		stmt, err := r.stmts.get(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := stmt.QueryContext(ctx, args...)
+		if attempt == 0 && isStaleStatement(err) {
+			r.stmts.invalidate(query, stmt)
+			continue
+		}
+		return rows, err
+	}
+}
+
+// queryRow runs the single row query and scans the row into dest, sql.ErrNoRows is returned as is
+func (r *repo) queryRow(ctx context.Context, query string, args []interface{}, dest ...interface{}) error {
+	if r.stmts == nil {
+		return r.db.QueryRowContext(ctx, query, args...).Scan(dest...)
+	}
+	for attempt := 0; ; attempt++ {
+		stmt, err := r.stmts.get(ctx, query)
+		if err != nil {
+			return err
+		}
+		err = stmt.QueryRowContext(ctx, args...).Scan(dest...)
+		if attempt == 0 && isStaleStatement(err) {
+			r.stmts.invalidate(query, stmt)
+			continue
+		}
+		return err
+	}
+}
+
+func (r *repo) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if r.stmts == nil {
+		return r.db.ExecContext(ctx, query, args...)
+	}
+	for attempt := 0; ; attempt++ {
+		stmt, err := r.stmts.get(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		res, err := stmt.ExecContext(ctx, args...)
+		if attempt == 0 && isStaleStatement(err) {
+			r.stmts.invalidate(query, stmt)
+			continue
+		}
+		return res, err
+	}
+}
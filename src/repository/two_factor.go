@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+// TOTP is the two-factor authentication key of a user
+type TOTP struct {
+	UserID int64
+	Secret string
+	// LastStep is the time step of the last accepted code
+	LastStep int64
+}
+
+type ITwoFactorRepository interface {
+	// GetTOTP returns the key of the user, ErrNotFound if the user has no two-factor authentication
+	GetTOTP(ctx context.Context, userID int64) (*TOTP, error)
+	// EnableTOTP stores the key of the user and replaces the recovery codes with the hashes of the new ones.
+	// step is the time step of the code that confirmed the key, it is already used.
+	EnableTOTP(ctx context.Context, userID int64, secret string, step int64, recoveryCodeHashes []string) error
+	// DisableTOTP deletes the key and the recovery codes of the user
+	DisableTOTP(ctx context.Context, userID int64) error
+	// UseTOTPStep accepts the time step if it is after the last accepted one, so a code can not be replayed
+	UseTOTPStep(ctx context.Context, userID int64, step int64) (bool, error)
+	// UseRecoveryCode marks the unused recovery code of the hash used, false if there is no such code
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error)
+	// CountRecoveryCodes is the number of the unused recovery codes of the user
+	CountRecoveryCodes(ctx context.Context, userID int64) (int, error)
+}
+
+func (r *repo) GetTOTP(ctx context.Context, userID int64) (*TOTP, error) {
+	const query = "SELECT user_id, secret, last_step FROM user_totp WHERE user_id = ?"
+	ctx, span := startSpan(ctx, "GetTOTP", query)
+	defer span.End()
+
+	totp := new(TOTP)
+	err := r.queryRow(ctx, query, []interface{}{userID}, &totp.UserID, &totp.Secret, &totp.LastStep)
+	if err == sql.ErrNoRows {
+		return nil, spanError(span, &Error{Kind: ErrNotFound, Op: "GetTOTP", Err: err})
+	}
+	if err != nil {
+		return nil, spanError(span, wrapError("GetTOTP", err))
+	}
+	return totp, nil
+}
+
+func (r *repo) EnableTOTP(ctx context.Context, userID int64, secret string, step int64, recoveryCodeHashes []string) error {
+	const (
+		totpQuery   = "INSERT INTO user_totp(user_id, secret, last_step, created_at) VALUES(?, ?, ?, UTC_TIMESTAMP())"
+		deleteQuery = "DELETE FROM recovery_codes WHERE user_id = ?"
+		codeQuery   = "INSERT INTO recovery_codes(user_id, code_hash) VALUES(?, ?)"
+	)
+	ctx, span := startSpan(ctx, "EnableTOTP", totpQuery)
+	defer span.End()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return spanError(span, wrapError("EnableTOTP", err))
+	}
+	defer tx.Rollback()
+
+	// a second enrollment racing the first one fails on the primary key with ErrConflict
+	if _, err := tx.ExecContext(ctx, totpQuery, userID, secret, step); err != nil {
+		return spanError(span, wrapError("EnableTOTP", err))
+	}
+	if _, err := tx.ExecContext(ctx, deleteQuery, userID); err != nil {
+		return spanError(span, wrapError("EnableTOTP", err))
+	}
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.ExecContext(ctx, codeQuery, userID, hash); err != nil {
+			return spanError(span, wrapError("EnableTOTP", err))
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return spanError(span, wrapError("EnableTOTP", err))
+	}
+	return nil
+}
+
+func (r *repo) DisableTOTP(ctx context.Context, userID int64) error {
+	const (
+		totpQuery  = "DELETE FROM user_totp WHERE user_id = ?"
+		codesQuery = "DELETE FROM recovery_codes WHERE user_id = ?"
+	)
+	ctx, span := startSpan(ctx, "DisableTOTP", totpQuery)
+	defer span.End()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return spanError(span, wrapError("DisableTOTP", err))
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, totpQuery, userID)
+	if err != nil {
+		return spanError(span, wrapError("DisableTOTP", err))
+	}
+	if _, err := tx.ExecContext(ctx, codesQuery, userID); err != nil {
+		return spanError(span, wrapError("DisableTOTP", err))
+	}
+	if err := tx.Commit(); err != nil {
+		return spanError(span, wrapError("DisableTOTP", err))
+	}
+	setRowsAffected(span, res)
+	return nil
+}
+
+func (r *repo) UseTOTPStep(ctx context.Context, userID int64, step int64) (bool, error) {
+	const query = "UPDATE user_totp SET last_step = ? WHERE user_id = ? AND last_step < ?"
+	ctx, span := startSpan(ctx, "UseTOTPStep", query)
+	defer span.End()
+
+	res, err := r.exec(ctx, query, step, userID, step)
+	if err != nil {
+		return false, spanError(span, wrapError("UseTOTPStep", err))
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, spanError(span, wrapError("UseTOTPStep", err))
+	}
+	span.SetAttribute("db.rows", n)
+	return n > 0, nil
+}
+
+func (r *repo) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	const query = "UPDATE recovery_codes SET used_at = UTC_TIMESTAMP() WHERE user_id = ? AND code_hash = ? AND used_at IS NULL"
+	ctx, span := startSpan(ctx, "UseRecoveryCode", query)
+	defer span.End()
+
+	res, err := r.exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, spanError(span, wrapError("UseRecoveryCode", err))
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, spanError(span, wrapError("UseRecoveryCode", err))
+	}
+	span.SetAttribute("db.rows", n)
+	return n > 0, nil
+}
+
+func (r *repo) CountRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	const query = "SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL"
+	ctx, span := startSpan(ctx, "CountRecoveryCodes", query)
+	defer span.End()
+
+	var n int
+	if err := r.queryRow(ctx, query, []interface{}{userID}, &n); err != nil {
+		return 0, spanError(span, wrapError("CountRecoveryCodes", err))
+	}
+	return n, nil
+}
@@ -1,10 +1,12 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"golang.org/x/crypto/bcrypt"
 	"log"
+	"otus-hiload/src/roles"
 	"strings"
 )
 
@@ -17,29 +19,43 @@ type User struct {
 	PasswordHash string
 	Description  string
 	PhotoFile    string
-	CreatedAt    sql.NullTime
+	Email        string
+	// SessionVersion is stored in the sessions of the user, the sessions of older versions are signed out
+	SessionVersion int
+	// Role is one of roles.All, BlockedAt is set while the user may not log in
+	Role      string
+	BlockedAt sql.NullTime
+	CreatedAt sql.NullTime
 }
 
 type IUserRepository interface {
 	GetDB() *sql.DB
-	GetAll() ([]*User, error)
-	Get(id int64) (*User, error)
-	Create(*User) error
-	Update(user *User) error
-	IsLoginExist(login string) bool
-	FindByLoginAndPassword(login string, password string) (*User, error)
-	FindByNamePrefix(prefix string, limit int, minId int64) ([]*User, error)
-	BulkCreate(users []*User)
+	GetAll(ctx context.Context) ([]*User, error)
+	Get(ctx context.Context, id int64) (*User, error)
+	Create(ctx context.Context, user *User) error
+	Update(ctx context.Context, user *User) error
+	IsLoginExist(ctx context.Context, login string) (bool, error)
+	GetByLogin(ctx context.Context, login string) (*User, error)
+	FindByLoginAndPassword(ctx context.Context, login string, password string) (*User, error)
+	FindByNamePrefix(ctx context.Context, prefix string, limit int, minId int64) ([]*User, error)
+	BulkCreate(ctx context.Context, users []*User)
 }
 
+// dummyPasswordHash is compared for unknown logins, it has the cost of the stored hashes
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
 func (r *repo) GetDB() *sql.DB {
 	return r.db
 }
 
-func (r *repo) GetAll() ([]*User, error) {
-	rows, err := r.db.Query("SELECT id, login, name, last_name, description, photo_file, created_at FROM users")
+func (r *repo) GetAll(ctx context.Context) ([]*User, error) {
+	const query = "SELECT id, login, name, last_name, description, photo_file, created_at FROM users"
+	ctx, span := startSpan(ctx, "GetAll", query)
+	defer span.End()
+
+	rows, err := r.query(ctx, query)
 	if err != nil {
-		return nil, err
+		return nil, spanError(span, wrapError("GetAll", err))
 	}
 	defer rows.Close()
 
@@ -48,66 +64,115 @@ func (r *repo) GetAll() ([]*User, error) {
 		user := new(User)
 		err := rows.Scan(&user.ID, &user.Login, &user.Name, &user.LastName, &user.Description, &user.PhotoFile, &user.CreatedAt)
 		if err != nil {
-			return nil, err
+			return nil, spanError(span, wrapError("GetAll", err))
 		}
 		users = append(users, user)
 	}
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, spanError(span, wrapError("GetAll", err))
 	}
 
+	span.SetAttribute("db.rows", len(users))
 	return users, nil
 }
 
-func (r *repo) Get(id int64) (*User, error) {
-	row := r.db.QueryRow("SELECT id, login, name, last_name, description, photo_file, created_at FROM users WHERE id = ?", id)
+func (r *repo) Get(ctx context.Context, id int64) (*User, error) {
+	const query = "SELECT id, login, name, last_name, description, photo_file, email, session_version, role, blocked_at, created_at " +
+		"FROM users WHERE id = ?"
+	ctx, span := startSpan(ctx, "Get", query)
+	defer span.End()
 
 	user := new(User)
-	err := row.Scan(&user.ID, &user.Login, &user.Name, &user.LastName, &user.Description, &user.PhotoFile, &user.CreatedAt)
+	err := r.queryRow(ctx, query, []interface{}{id},
+		&user.ID, &user.Login, &user.Name, &user.LastName, &user.Description, &user.PhotoFile, &user.Email,
+		&user.SessionVersion, &user.Role, &user.BlockedAt, &user.CreatedAt)
 	if err != nil {
-		return nil, err
+		return nil, spanError(span, wrapError("Get", err))
 	}
+	span.SetAttribute("db.rows", 1)
 	return user, nil
 }
 
-func (r *repo) Update(user *User) error {
-	_, err := r.db.Exec("UPDATE users set description = ?, photo_file = ? where id = ?", user.Description, user.PhotoFile, user.ID)
+func (r *repo) Update(ctx context.Context, user *User) error {
+	const query = "UPDATE users set description = ?, photo_file = ? where id = ?"
+	ctx, span := startSpan(ctx, "Update", query)
+	defer span.End()
+
+	res, err := r.exec(ctx, query, user.Description, user.PhotoFile, user.ID)
 
 	if err != nil {
-		return err
+		return spanError(span, wrapError("Update", err))
 	}
 
+	setRowsAffected(span, res)
 	return nil
 }
 
-func (r *repo) IsLoginExist(login string) bool {
-	row := r.db.QueryRow("SELECT id FROM users WHERE login = ?", login)
+// NormalizeLogin returns the canonical form of the login: logins are unique regardless of case and surrounding spaces
+func NormalizeLogin(login string) string {
+	return strings.ToLower(strings.TrimSpace(login))
+}
+
+func (r *repo) IsLoginExist(ctx context.Context, login string) (bool, error) {
+	const query = "SELECT id FROM users WHERE login = ?"
+	ctx, span := startSpan(ctx, "IsLoginExist", query)
+	defer span.End()
 
 	user := new(User)
-	err := row.Scan(&user.ID)
+	err := r.queryRow(ctx, query, []interface{}{NormalizeLogin(login)}, &user.ID)
 
 	if err == sql.ErrNoRows {
-		return false
+		span.SetAttribute("db.rows", 0)
+		return false, nil
 	}
 
 	if err != nil {
-		log.Printf("IsLoginExist error: %s", err.Error())
+		return false, spanError(span, wrapError("IsLoginExist", err))
 	}
 
-	return true
+	span.SetAttribute("db.rows", 1)
+	return true, nil
+}
+
+func (r *repo) GetByLogin(ctx context.Context, login string) (*User, error) {
+	const query = "SELECT id, login, name, last_name, description, photo_file, email, session_version, role, blocked_at, created_at " +
+		"FROM users WHERE login = ?"
+	ctx, span := startSpan(ctx, "GetByLogin", query)
+	defer span.End()
+
+	user := new(User)
+	err := r.queryRow(ctx, query, []interface{}{NormalizeLogin(login)},
+		&user.ID, &user.Login, &user.Name, &user.LastName, &user.Description, &user.PhotoFile, &user.Email,
+		&user.SessionVersion, &user.Role, &user.BlockedAt, &user.CreatedAt)
+	if err != nil {
+		return nil, spanError(span, wrapError("GetByLogin", err))
+	}
+	span.SetAttribute("db.rows", 1)
+	return user, nil
 }
 
-func (r *repo) FindByLoginAndPassword(login string, password string) (*User, error) {
-	row := r.db.QueryRow("SELECT id, login, name, last_name, password_hash, description, photo_file, created_at FROM users WHERE login = ?", login)
+func (r *repo) FindByLoginAndPassword(ctx context.Context, login string, password string) (*User, error) {
+	const query = "SELECT id, login, name, last_name, password_hash, description, photo_file, email, session_version, " +
+		"role, blocked_at, created_at FROM users WHERE login = ?"
+	ctx, span := startSpan(ctx, "FindByLoginAndPassword", query)
+	defer span.End()
 
 	user := new(User)
-	err := row.Scan(&user.ID, &user.Login, &user.Name, &user.LastName, &user.PasswordHash, &user.Description, &user.PhotoFile, &user.CreatedAt)
+	err := r.queryRow(ctx, query, []interface{}{NormalizeLogin(login)},
+		&user.ID, &user.Login, &user.Name, &user.LastName, &user.PasswordHash, &user.Description, &user.PhotoFile,
+		&user.Email, &user.SessionVersion, &user.Role, &user.BlockedAt, &user.CreatedAt)
+	if err == sql.ErrNoRows {
+		// an unknown login costs the same bcrypt compare as a wrong password, the response time does not tell them apart
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return nil, spanError(span, &Error{Kind: ErrInvalidCredentials, Op: "FindByLoginAndPassword", Err: err})
+	}
 	if err != nil {
-		return nil, err
+		return nil, spanError(span, wrapError("FindByLoginAndPassword", err))
 	}
+	span.SetAttribute("db.rows", 1)
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return nil, err
+		return nil, spanError(span, &Error{Kind: ErrInvalidCredentials, Op: "FindByLoginAndPassword", Err: err})
 	}
 
 	user.PasswordHash = ""
@@ -115,13 +180,16 @@ func (r *repo) FindByLoginAndPassword(login string, password string) (*User, err
 	return user, nil
 }
 
-func (r *repo) FindByNamePrefix(prefix string, limit int, minId int64) ([]*User, error) {
+func (r *repo) FindByNamePrefix(ctx context.Context, prefix string, limit int, minId int64) ([]*User, error) {
+	const query = "(select id, name, last_name from users where id>? and name like ? limit 1000) " +
+		"union (select id, name, last_name from users where id>? and last_name like ? limit 1000) " +
+		"order by id asc limit ?"
+	ctx, span := startSpan(ctx, "FindByNamePrefix", query)
+	defer span.End()
 
-	rows, err := r.db.Query("(select id, name, last_name from users where id>? and name like ? limit 1000) "+
-		"union (select id, name, last_name from users where id>? and last_name like ? limit 1000) "+
-		"order by id asc limit ?", minId, prefix+"%", minId, prefix+"%", limit)
+	rows, err := r.query(ctx, query, minId, prefix+"%", minId, prefix+"%", limit)
 	if err != nil {
-		return nil, err
+		return nil, spanError(span, wrapError("FindByNamePrefix", err))
 	}
 	defer rows.Close()
 
@@ -130,42 +198,51 @@ func (r *repo) FindByNamePrefix(prefix string, limit int, minId int64) ([]*User,
 		user := new(User)
 		err := rows.Scan(&user.ID, &user.Name, &user.LastName)
 		if err != nil {
-			return nil, err
+			return nil, spanError(span, wrapError("FindByNamePrefix", err))
 		}
 		users = append(users, user)
 	}
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, spanError(span, wrapError("FindByNamePrefix", err))
 	}
 
+	span.SetAttribute("db.rows", len(users))
 	return users, nil
 }
 
-func (r *repo) Create(user *User) error {
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+func (r *repo) Create(ctx context.Context, user *User) error {
+	passwordHash, err := hashPassword(user.Password)
 	if err != nil {
 		return err
 	}
 
-	res, err := r.db.Exec("INSERT INTO users(login, name, last_name, password_hash, created_at) VALUES(?, ?, ?, ?, NOW())",
-		user.Login, user.Name, user.LastName, passwordHash)
+	const query = "INSERT INTO users(login, name, last_name, password_hash, email, created_at) VALUES(?, ?, ?, ?, ?, NOW())"
+	ctx, span := startSpan(ctx, "Create", query)
+	defer span.End()
+
+	user.Login = NormalizeLogin(user.Login)
+	// uniqueness is enforced by the users_login_uidx index, concurrent registrations of the same login get ErrConflict
+	res, err := r.exec(ctx, query, user.Login, user.Name, user.LastName, passwordHash, user.Email)
 
 	if err != nil {
-		return err
+		return spanError(span, wrapError("Create", err))
 	}
 
 	userID, err := res.LastInsertId()
 
 	if err != nil {
-		return err
+		return spanError(span, wrapError("Create", err))
 	}
 
 	user.ID = userID
+	// the column default, roles are granted by the administrators
+	user.Role = roles.User
+	setRowsAffected(span, res)
 
 	return nil
 }
 
-func (r *repo) BulkCreate(users []*User) {
+func (r *repo) BulkCreate(ctx context.Context, users []*User) {
 	size := 500
 	for min := 0; min < len(users); min = min + size {
 		max := min + size
@@ -174,25 +251,32 @@ func (r *repo) BulkCreate(users []*User) {
 		}
 		log.Printf("bulk: %d - %d", min, max)
 		batch := users[min:max]
-		err := r.bulkCreate(batch)
+		err := r.bulkCreate(ctx, batch)
 		if err != nil {
 			log.Printf("bulkCreate error: %s", err.Error())
 		}
 	}
 }
 
-func (r *repo) bulkCreate(users []*User) error {
+func (r *repo) bulkCreate(ctx context.Context, users []*User) error {
 	valueStrings := make([]string, 0, len(users))
 	valueArgs := make([]interface{}, 0, len(users)*5)
 	for _, user := range users {
 		valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, NOW())")
-		valueArgs = append(valueArgs, user.Login)
+		valueArgs = append(valueArgs, NormalizeLogin(user.Login))
 		valueArgs = append(valueArgs, user.Name)
 		valueArgs = append(valueArgs, user.LastName)
 		valueArgs = append(valueArgs, user.PasswordHash)
 		valueArgs = append(valueArgs, user.Description)
 	}
 	stmt := fmt.Sprintf("INSERT INTO users(login, name, last_name, password_hash, description, created_at) VALUES %s", strings.Join(valueStrings, ","))
-	_, err := r.db.Exec(stmt, valueArgs...)
-	return err
+	ctx, span := startSpan(ctx, "BulkCreate", "INSERT INTO users(login, name, last_name, password_hash, description, created_at) VALUES ...")
+	defer span.End()
+
+	res, err := r.db.ExecContext(ctx, stmt, valueArgs...)
+	if err != nil {
+		return spanError(span, err)
+	}
+	setRowsAffected(span, res)
+	return nil
 }
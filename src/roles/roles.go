@@ -0,0 +1,37 @@
+package roles
+
+// The roles of the users, each one has the rights of the lower ones
+const (
+	User      = "user"
+	Moderator = "moderator"
+	Admin     = "admin"
+)
+
+// All roles from the lowest
+var All = []string{User, Moderator, Admin}
+
+func rank(role string) int {
+	for i, r := range All {
+		if r == role {
+			return i
+		}
+	}
+	// an unknown role has no rights, not even those of User
+	return -1
+}
+
+// Valid tells if role is one of All
+func Valid(role string) bool {
+	return rank(role) >= 0
+}
+
+// AtLeast tells if role has the rights of required
+func AtLeast(role string, required string) bool {
+	r := rank(role)
+	return r >= 0 && r >= rank(required)
+}
+
+// Outranks tells if role is higher than other: only a higher role may manage a user
+func Outranks(role string, other string) bool {
+	return rank(role) > rank(other)
+}
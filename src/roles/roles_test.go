@@ -0,0 +1,65 @@
+package roles
+
+import "testing"
+
+func TestOutranks(t *testing.T) {
+	tests := []struct {
+		role  string
+		other string
+		want  bool
+	}{
+		{Admin, Admin, false},
+		{Admin, Moderator, true},
+		{Admin, User, true},
+		{Moderator, Admin, false},
+		{Moderator, Moderator, false},
+		{Moderator, User, true},
+		{User, Admin, false},
+		{User, Moderator, false},
+		{User, User, false},
+		// an unknown role outranks nobody, but everybody manages it
+		{"root", User, false},
+		{User, "root", true},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if got := Outranks(tt.role, tt.other); got != tt.want {
+			t.Errorf("Outranks(%q, %q) = %v, want %v", tt.role, tt.other, got, tt.want)
+		}
+	}
+}
+
+func TestAtLeast(t *testing.T) {
+	tests := []struct {
+		role     string
+		required string
+		want     bool
+	}{
+		{Admin, Admin, true},
+		{Admin, Moderator, true},
+		{Moderator, Admin, false},
+		{Moderator, Moderator, true},
+		{User, Moderator, false},
+		{User, User, true},
+		{"", User, false},
+		{"root", User, false},
+	}
+	for _, tt := range tests {
+		if got := AtLeast(tt.role, tt.required); got != tt.want {
+			t.Errorf("AtLeast(%q, %q) = %v, want %v", tt.role, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	for _, role := range All {
+		if !Valid(role) {
+			t.Errorf("Valid(%q) = false", role)
+		}
+	}
+	for _, role := range []string{"", "root", "Admin"} {
+		if Valid(role) {
+			t.Errorf("Valid(%q) = true", role)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"otus-hiload/src/constants"
+	"otus-hiload/src/middleware"
+	"otus-hiload/src/repository"
+	"otus-hiload/src/roles"
+	"strconv"
+	"strings"
+)
+
+type IAdminService interface {
+	AdminUsersHandler(w http.ResponseWriter, r *http.Request)
+	AdminUserHandler(w http.ResponseWriter, r *http.Request)
+}
+
+const (
+	adminPageSize   = 50
+	adminAuditLimit = 20
+)
+
+// AdminUsersHandler lists the users to the staff, q searches by the start of the login, name, last name or email
+func (s *userService) AdminUsersHandler(w http.ResponseWriter, r *http.Request) {
+	queryValues := r.URL.Query()
+	q := strings.TrimSpace(queryValues.Get("q"))
+	afterID, _ := strconv.ParseInt(queryValues.Get("after"), 10, 64)
+
+	params := make(map[string]interface{})
+	params["q"] = q
+	users, err := s.AdminRepository.FindUsers(r.Context(), q, adminPageSize+1, afterID)
+	if err != nil {
+		s.renderFormError(w, r, "admin_users", params, err)
+		return
+	}
+	if len(users) > adminPageSize {
+		users = users[:adminPageSize]
+		params["next"] = users[adminPageSize-1].ID
+	}
+	params["users"] = users
+	s.renderFormParams(w, r, "admin_users", params)
+}
+
+// AdminUserHandler shows the user to the staff and blocks, unblocks, signs out the user or changes the role
+func (s *userService) AdminUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		s.renderError(w, r, repository.ErrNotFound)
+		return
+	}
+	actor, err := s.getUserFromContext(ctx)
+	if err != nil {
+		s.renderError(w, r, err)
+		return
+	}
+	target, err := s.UserRepository.Get(ctx, id)
+	if err != nil {
+		s.renderError(w, r, err)
+		return
+	}
+	// the current role checked by the role middleware, not the one in the session
+	actorRole, _ := ctx.Value(constants.CtxUserRole).(string)
+
+	entry := &repository.AuditEntry{UserID: auditUser(target.ID), ActorID: auditUser(actor.ID), Login: target.Login,
+		IP: middleware.ClientIP(r)}
+	if r.Method == "POST" {
+		if err := s.adminAction(ctx, r, actor.ID, actorRole, target, entry); err != nil {
+			s.renderError(w, r, err)
+			return
+		}
+		s.audit(ctx, entry)
+		http.Redirect(w, r, constants.AdminUsersPath+"/"+strconv.FormatInt(target.ID, 10), http.StatusFound)
+		return
+	}
+
+	params := make(map[string]interface{})
+	if err := s.adminUserParams(ctx, target, params); err != nil {
+		s.renderError(w, r, err)
+		return
+	}
+	// the staff sees the email and the sessions of the user, the access is audited like the changes
+	entry.Action = repository.AuditAdminUserViewed
+	s.audit(ctx, entry)
+
+	params["user"] = target
+	canManage := actor.ID != target.ID && roles.Outranks(actorRole, target.Role)
+	params["can_manage"] = canManage
+	params["can_change_role"] = canManage && roles.AtLeast(actorRole, roles.Admin)
+	params["roles"] = roles.All
+	s.renderFormParams(w, r, "admin_user", params)
+}
+
+func (s *userService) adminUserParams(ctx context.Context, target *repository.User, params map[string]interface{}) error {
+	list, err := s.sessions.List(ctx, target.ID)
+	if err != nil {
+		return err
+	}
+	_, err = s.TwoFactorRepository.GetTOTP(ctx, target.ID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+	twoFactor := err == nil
+	audit, err := s.AuditRepository.GetUserAuditEntries(ctx, target.ID, adminAuditLimit)
+	if err != nil {
+		return err
+	}
+	params["sessions"] = list
+	params["two_factor"] = twoFactor
+	params["audit"] = audit
+	return nil
+}
+
+// adminAction applies the action of the form and fills the audit entry of it. A user is managed only by
+// a higher role: moderators manage the users, administrators manage the moderators too. Nobody manages themselves,
+// so the last administrator can not lock themselves out.
+func (s *userService) adminAction(ctx context.Context, r *http.Request, actorID int64, actorRole string,
+	target *repository.User, entry *repository.AuditEntry) error {
+	if actorID == target.ID || !roles.Outranks(actorRole, target.Role) {
+		return forbidden("admin.forbidden")
+	}
+
+	switch r.PostFormValue("action") {
+	case "block":
+		// the session version signs out the sessions on their next request, the store deletes them right away
+		if err := s.AdminRepository.SetBlocked(ctx, target.ID, true); err != nil {
+			return err
+		}
+		_, err := s.sessions.RevokeAll(ctx, target.ID, "")
+		s.logError(ctx, "admin block revoke sessions", err)
+		entry.Action = repository.AuditAdminUserBlocked
+		// the reason is kept in the audit log only
+		entry.Details = strings.TrimSpace(r.PostFormValue("reason"))
+	case "unblock":
+		if err := s.AdminRepository.SetBlocked(ctx, target.ID, false); err != nil {
+			return err
+		}
+		entry.Action = repository.AuditAdminUserUnblocked
+	case "logout":
+		if err := s.AdminRepository.IncrementSessionVersion(ctx, target.ID); err != nil {
+			return err
+		}
+		n, err := s.sessions.RevokeAll(ctx, target.ID, "")
+		s.logError(ctx, "admin revoke sessions", err)
+		entry.Action = repository.AuditAdminSessionsRevoked
+		entry.Details = strconv.Itoa(n)
+	case "role":
+		if !roles.AtLeast(actorRole, roles.Admin) {
+			return forbidden("admin.forbidden")
+		}
+		role := r.PostFormValue("role")
+		if !roles.Valid(role) {
+			return badRequest("admin.invalid_role", role)
+		}
+		if err := s.AdminRepository.SetRole(ctx, target.ID, role); err != nil {
+			return err
+		}
+		entry.Action = repository.AuditAdminRoleChanged
+		entry.Details = target.Role + " -> " + role
+	default:
+		return badRequest("admin.unknown_action")
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"encoding/json"
+	"html"
+	"net/http"
+	"otus-hiload/src/middleware"
+	"otus-hiload/src/repository"
+	"otus-hiload/src/validation"
+)
+
+// IAPIService is the JSON API, it validates the input by the same rules as the HTML forms
+type IAPIService interface {
+	APIRegisterHandler(w http.ResponseWriter, r *http.Request)
+	APIUpdateMeHandler(w http.ResponseWriter, r *http.Request)
+	APICSRFHandler(w http.ResponseWriter, r *http.Request)
+}
+
+const maxAPIBodySize = 64 << 10 // 64 KB
+
+type apiUser struct {
+	ID          int64  `json:"id"`
+	Login       string `json:"login,omitempty"`
+	Name        string `json:"name"`
+	LastName    string `json:"last_name"`
+	Description string `json:"description,omitempty"`
+}
+
+func newAPIUser(user *repository.User) *apiUser {
+	return &apiUser{
+		ID:          user.ID,
+		Login:       user.Login,
+		Name:        user.Name,
+		LastName:    user.LastName,
+		Description: html.UnescapeString(user.Description),
+	}
+}
+
+// decodeJSON reads the request body into v, unknown fields are rejected so typos do not pass silently
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return badRequest("api.invalid_json")
+	}
+	return nil
+}
+
+// renderAPIError always responds with JSON, whatever the Accept header is
+func (s *userService) renderAPIError(w http.ResponseWriter, r *http.Request, err error) {
+	status, message := s.errorResponse(r.Context(), r.URL.Path, err)
+	setRetryAfter(w, err)
+	body := map[string]interface{}{"status": status, "error": message}
+	if fields := fieldErrors(r.Context(), err); fields != nil {
+		body["fields"] = fields
+	}
+	s.writeJSON(w, r, status, body)
+}
+
+// APIRegisterHandler creates the user: POST {"login", "name", "last_name", "password", "password_confirm"}
+func (s *userService) APIRegisterHandler(w http.ResponseWriter, r *http.Request) {
+	form := new(registrationForm)
+	if err := decodeJSON(w, r, form); err != nil {
+		s.renderAPIError(w, r, err)
+		return
+	}
+
+	user, err := s.register(r.Context(), form)
+	if err != nil {
+		s.renderAPIError(w, r, err)
+		return
+	}
+	s.writeJSON(w, r, http.StatusCreated, newAPIUser(user))
+}
+
+// APIUpdateMeHandler changes the description of the current user: PUT {"description"}
+func (s *userService) APIUpdateMeHandler(w http.ResponseWriter, r *http.Request) {
+	form := new(profileForm)
+	if err := decodeJSON(w, r, form); err != nil {
+		s.renderAPIError(w, r, err)
+		return
+	}
+
+	var v validation.Validator
+	form.validate(&v)
+	if err := v.Err(); err != nil {
+		s.renderAPIError(w, r, err)
+		return
+	}
+
+	user, err := s.getUserFromContext(r.Context())
+	if err != nil {
+		s.renderAPIError(w, r, err)
+		return
+	}
+	user.Description = html.EscapeString(form.Description)
+	err = s.UserRepository.Update(r.Context(), user)
+	if err != nil {
+		s.renderAPIError(w, r, err)
+		return
+	}
+	s.writeJSON(w, r, http.StatusOK, newAPIUser(user))
+}
+
+// APICSRFHandler returns the CSRF token of the session to the API clients authenticated by the session cookie:
+// GET {"csrf_token"}. Other sites can not read the response, the same-origin policy keeps it from them.
+func (s *userService) APICSRFHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := middleware.CSRFToken(r.Context(), s.sessionManager)
+	if err != nil {
+		s.renderAPIError(w, r, err)
+		return
+	}
+	s.writeJSON(w, r, http.StatusOK, map[string]string{"csrf_token": token})
+}
@@ -1,41 +1,89 @@
 package service
 
 import (
+	"bytes"
 	"context"
-	"html/template"
-	"log"
 	"net/http"
 	"otus-hiload/src/constants"
+	"otus-hiload/src/i18n"
+	"otus-hiload/src/logger"
+	"otus-hiload/src/middleware"
 	"otus-hiload/src/repository"
+	"otus-hiload/src/roles"
+	"otus-hiload/src/tracing"
 )
 
-func (s *userService) logError(msg string, err error) {
+// logError logs err with the request logger, so the line carries the request id
+func (s *userService) logError(ctx context.Context, msg string, err error) {
 	if err != nil {
-		log.Printf(msg+": %s", err.Error())
+		logger.FromContext(ctx).Error(msg, "error", err)
 	}
 }
 
-func (s *userService) renderForm(w http.ResponseWriter, form string, error error) {
-	params := make(map[string]string)
+func (s *userService) renderForm(w http.ResponseWriter, r *http.Request, form string, error error) {
+	params := make(map[string]interface{})
 	if error != nil {
-		s.logError("renderForm "+form, error)
-		params["error"] = error.Error()
-		w.WriteHeader(http.StatusInternalServerError)
+		s.renderFormError(w, r, form, params, error)
+		return
 	}
-	t, _ := template.ParseFiles("templates/" + form + ".html")
-	err := t.Execute(w, params)
-	s.logError(form+" template execute error: %s", err)
+	s.renderFormParams(w, r, form, params)
 }
 
-func (s *userService) renderFormParams(w http.ResponseWriter, form string, params interface{}) {
-	t, _ := template.ParseFiles("templates/" + form + ".html")
-	err := t.Execute(w, params)
-	s.logError(form+" template execute error: %s", err)
+// renderFormError renders form with the error message and the response status matching the error
+func (s *userService) renderFormError(w http.ResponseWriter, r *http.Request, form string, params map[string]interface{}, error error) {
+	status, message := s.errorResponse(r.Context(), "renderForm "+form, error)
+	setRetryAfter(w, error)
+	params["error"] = message
+	params["fields"] = fieldErrors(r.Context(), error)
+	s.renderPage(w, r, form, status, params)
+}
+
+func (s *userService) renderFormParams(w http.ResponseWriter, r *http.Request, form string, params map[string]interface{}) {
+	s.renderPage(w, r, form, http.StatusOK, params)
+}
+
+// renderPage renders the page to a buffer first, so a failed template turns into a clean 500 response
+func (s *userService) renderPage(w http.ResponseWriter, r *http.Request, form string, status int, params map[string]interface{}) {
+	_, span := tracing.Start(r.Context(), "template."+form)
+	defer span.End()
+
+	locale := i18n.FromContext(r.Context()).Locale()
+	params["authenticated"] = s.sessionManager.GetBool(r.Context(), constants.CtxAuthenticated)
+	// only the link depends on the session role, the admin pages check the current one
+	params["staff"] = roles.AtLeast(s.sessionManager.GetString(r.Context(), constants.CtxUserRole), roles.Moderator)
+	params["locale"] = locale
+	params["locales"] = i18n.Locales()
+	params["path"] = r.URL.RequestURI()
+	csrfToken, err := middleware.CSRFToken(r.Context(), s.sessionManager)
+	if err != nil {
+		span.SetError(err)
+		s.logError(r.Context(), form+" csrf token", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	params["csrf"] = csrfToken
+	if _, ok := params["fields"]; !ok {
+		params["fields"] = map[string]string{}
+	}
+
+	var buf bytes.Buffer
+	err = s.templates.Render(&buf, locale, form, params)
+	if err != nil {
+		span.SetError(err)
+		s.logError(r.Context(), form+" template execute", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, err = buf.WriteTo(w)
+	s.logError(r.Context(), form+" template write", err)
 }
 
 func (s *userService) getUserFromContext(ctx context.Context) (*repository.User, error) {
 	userId := (ctx.Value(constants.CtxUserId)).(int64)
-	return s.UserRepository.Get(userId)
+	return s.UserRepository.Get(ctx, userId)
 }
 
 func (s *userService) setAuthenticated(ctx context.Context, user *repository.User) error {
@@ -43,17 +91,29 @@ func (s *userService) setAuthenticated(ctx context.Context, user *repository.Use
 	if err != nil {
 		return err
 	}
+	// a new CSRF token for the new privilege level, the old one may have leaked while anonymous
+	s.sessionManager.Remove(ctx, constants.CtxCSRFToken)
+	s.clearTwoFactor(ctx)
 	s.sessionManager.Put(ctx, constants.CtxAuthenticated, true)
 	s.sessionManager.Put(ctx, constants.CtxUserId, user.ID)
-	return nil
+	s.sessionManager.Put(ctx, constants.CtxSessionVersion, user.SessionVersion)
+	s.sessionManager.Put(ctx, constants.CtxUserRole, user.Role)
+	return s.sessions.Start(ctx)
 }
 
 func (s *userService) setUnauthenticated(ctx context.Context) error {
+	// the session leaves the list of the user sessions even if the registry write fails, the token renewal signs it out
+	s.logError(ctx, "session end", s.sessions.End(ctx))
 	err := s.sessionManager.RenewToken(ctx)
 	if err != nil {
 		return err
 	}
+	s.sessionManager.Remove(ctx, constants.CtxCSRFToken)
+	s.clearTwoFactor(ctx)
+	s.sessionManager.Remove(ctx, constants.CtxTOTPEnrollSecret)
 	s.sessionManager.Put(ctx, constants.CtxAuthenticated, false)
 	s.sessionManager.Put(ctx, constants.CtxUserId, nil)
+	s.sessionManager.Remove(ctx, constants.CtxSessionVersion)
+	s.sessionManager.Remove(ctx, constants.CtxUserRole)
 	return nil
 }
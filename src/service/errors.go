@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"otus-hiload/src/i18n"
+	"otus-hiload/src/middleware"
+	"otus-hiload/src/repository"
+	"otus-hiload/src/validation"
+	"strings"
+	"time"
+)
+
+// userError is an error which message is safe to show to the user, it is translated to the request locale
+type userError struct {
+	status  int
+	message func(l *i18n.Localizer) string
+	// retryAfter is sent in the Retry-After header if set
+	retryAfter time.Duration
+}
+
+func (e *userError) Error() string {
+	return e.message(i18n.New(i18n.DefaultLocale))
+}
+
+// badRequest is the message key of the i18n catalog with its format args
+func badRequest(key string, args ...interface{}) error {
+	return &userError{status: http.StatusBadRequest, message: func(l *i18n.Localizer) string {
+		return l.T(key, args...)
+	}}
+}
+
+func forbidden(key string, args ...interface{}) error {
+	return &userError{status: http.StatusForbidden, message: func(l *i18n.Localizer) string {
+		return l.T(key, args...)
+	}}
+}
+
+func conflict(key string, args ...interface{}) error {
+	return &userError{status: http.StatusConflict, message: func(l *i18n.Localizer) string {
+		return l.T(key, args...)
+	}}
+}
+
+func unavailable(key string, args ...interface{}) error {
+	return &userError{status: http.StatusServiceUnavailable, message: func(l *i18n.Localizer) string {
+		return l.T(key, args...)
+	}}
+}
+
+// tooManyRequests is the plural message key, it gets the wait in seconds
+func tooManyRequests(key string, wait time.Duration) error {
+	seconds := middleware.RetryAfterSeconds(wait)
+	return &userError{status: http.StatusTooManyRequests, retryAfter: wait, message: func(l *i18n.Localizer) string {
+		return l.N(key, seconds)
+	}}
+}
+
+// setRetryAfter tells the client when to retry the request failed with err
+func setRetryAfter(w http.ResponseWriter, err error) {
+	var uErr *userError
+	if errors.As(err, &uErr) && uErr.retryAfter > 0 {
+		middleware.SetRetryAfter(w, uErr.retryAfter)
+	}
+}
+
+// errorResponse maps err to the response status and the message shown to the user.
+// Internal details are logged and never returned.
+func (s *userService) errorResponse(ctx context.Context, op string, err error) (int, string) {
+	l := i18n.FromContext(ctx)
+	var uErr *userError
+	if errors.As(err, &uErr) {
+		return uErr.status, uErr.message(l)
+	}
+	var vErrs validation.Errors
+	if errors.As(err, &vErrs) {
+		return http.StatusBadRequest, l.T("validation.form")
+	}
+
+	s.logError(ctx, op, err)
+
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return http.StatusNotFound, l.T("error.not_found")
+	case errors.Is(err, repository.ErrConflict):
+		return http.StatusConflict, l.T("error.conflict")
+	case errors.Is(err, repository.ErrInvalidCredentials):
+		return http.StatusUnauthorized, l.T("error.invalid_credentials")
+	case errors.Is(err, repository.ErrUnavailable):
+		return http.StatusServiceUnavailable, l.T("error.unavailable")
+	default:
+		return http.StatusInternalServerError, l.T("error.internal")
+	}
+}
+
+// fieldErrors returns the translated messages of the invalid fields, nil if err is not a validation error
+func fieldErrors(ctx context.Context, err error) map[string]string {
+	var vErrs validation.Errors
+	if !errors.As(err, &vErrs) {
+		return nil
+	}
+	return vErrs.Messages(i18n.FromContext(ctx))
+}
+
+// renderError renders the error page (or its JSON equivalent if the client asks for JSON) instead of the requested one
+func (s *userService) renderError(w http.ResponseWriter, r *http.Request, err error) {
+	status, message := s.errorResponse(r.Context(), r.URL.Path, err)
+	setRetryAfter(w, err)
+
+	if wantsJSON(r) {
+		body := map[string]interface{}{"status": status, "error": message}
+		if fields := fieldErrors(r.Context(), err); fields != nil {
+			body["fields"] = fields
+		}
+		s.writeJSON(w, r, status, body)
+		return
+	}
+
+	params := make(map[string]interface{})
+	params["status"] = status
+	params["error"] = message
+	s.renderPage(w, r, "error", status, params)
+}
+
+func (s *userService) writeJSON(w http.ResponseWriter, r *http.Request, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(body)
+	s.logError(r.Context(), "json encode", err)
+}
+
+func wantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
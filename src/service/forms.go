@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"html"
+	"otus-hiload/src/constants"
+	"otus-hiload/src/repository"
+	"otus-hiload/src/validation"
+	"strings"
+)
+
+const (
+	maxPhotoSize = constants.MaxUploadSize
+	// maxDescriptionLength is the size of users.description, the description is stored HTML escaped
+	maxDescriptionLength = 1000
+	minPasswordLength    = 8
+)
+
+var photoTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+// registrationForm is filled from the HTML form or the JSON API, both are validated by the same rules
+type registrationForm struct {
+	Login           string `json:"login"`
+	Name            string `json:"name"`
+	LastName        string `json:"last_name"`
+	Email           string `json:"email"`
+	Password        string `json:"password"`
+	PasswordConfirm string `json:"password_confirm"`
+}
+
+func (f *registrationForm) validate() error {
+	f.Name = strings.TrimSpace(f.Name)
+	f.LastName = strings.TrimSpace(f.LastName)
+
+	var v validation.Validator
+	v.Check("login", repository.NormalizeLogin(f.Login),
+		validation.Required(), validation.MinRunes(3), validation.MaxRunes(32), validation.Login())
+	v.Check("name", f.Name, validation.Required(), validation.MaxRunes(100), validation.Name())
+	v.Check("last_name", f.LastName, validation.Required(), validation.MaxRunes(100), validation.Name())
+	f.Email = strings.TrimSpace(f.Email)
+	if len(f.Email) > 0 {
+		v.Check("email", f.Email, validation.MaxRunes(255), validation.Email())
+	}
+	checkNewPassword(&v, f.Password, f.PasswordConfirm)
+	return v.Err()
+}
+
+// checkNewPassword applies the password rules of the registration to a new password and its confirmation
+func checkNewPassword(v *validation.Validator, password string, confirm string) {
+	v.Check("password", password, validation.Required(), validation.Password(minPasswordLength))
+	v.Check("password_confirm", confirm, validation.Required(), validation.Equal(password, "reg.password_mismatch"))
+}
+
+type profileForm struct {
+	Description string `json:"description"`
+}
+
+func (f *profileForm) validate(v *validation.Validator) {
+	v.Check("description", f.Description, validation.Required(), validation.MinRunes(minDescriptionLength))
+	if v.Valid("description") {
+		// the limit applies to the stored escaped text
+		v.Check("description", html.EscapeString(f.Description), validation.MaxRunes(maxDescriptionLength))
+	}
+}
+
+// register validates the form and creates the user, a taken login is a conflict
+func (s *userService) register(ctx context.Context, form *registrationForm) (*repository.User, error) {
+	if err := form.validate(); err != nil {
+		return nil, err
+	}
+
+	loginTaken := conflict("reg.login_taken", form.Login)
+	exist, err := s.UserRepository.IsLoginExist(ctx, form.Login)
+	if err != nil {
+		return nil, err
+	}
+	if exist {
+		return nil, loginTaken
+	}
+
+	user := new(repository.User)
+	user.Login = form.Login
+	user.Name = form.Name
+	user.LastName = form.LastName
+	user.Email = form.Email
+	user.Password = form.Password
+	err = s.UserRepository.Create(ctx, user)
+	if errors.Is(err, repository.ErrConflict) {
+		// the login was taken by a concurrent registration after the IsLoginExist check
+		return nil, loginTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"net/http"
+	"net/url"
+	"otus-hiload/src/constants"
+	"otus-hiload/src/i18n"
+	"strings"
+)
+
+// LocaleHandler keeps the locale chosen by the user in the session and returns to the page it was chosen on
+func (s *userService) LocaleHandler(w http.ResponseWriter, r *http.Request) {
+	locale := r.FormValue("locale")
+	if !i18n.IsSupported(locale) {
+		s.renderError(w, r, badRequest("locale.unsupported", locale))
+		return
+	}
+	s.sessionManager.Put(r.Context(), constants.CtxLocale, locale)
+
+	http.Redirect(w, r, localPath(r.FormValue("back")), http.StatusSeeOther)
+}
+
+// localPath returns back if it is a path on this site, otherwise the root. "//host" is a protocol relative url
+// to another site and browsers read "/\host" the same way, so backslashes and control characters are refused.
+func localPath(back string) string {
+	if !strings.HasPrefix(back, "/") || strings.ContainsAny(back, "\\\t\r\n") {
+		return constants.RootPath
+	}
+	u, err := url.Parse(back)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.User != nil || strings.HasPrefix(u.Path, "//") {
+		return constants.RootPath
+	}
+	return back
+}
@@ -0,0 +1,26 @@
+package service
+
+import "testing"
+
+func TestLocalPath(t *testing.T) {
+	tests := []struct {
+		back string
+		want string
+	}{
+		{"/user/42", "/user/42"},
+		{"/search?q=an&after=10", "/search?q=an&after=10"},
+		{"", "/"},
+		{"user/42", "/"},
+		{"//evil.example", "/"},
+		{"/\\evil.example", "/"},
+		{"/\\/evil.example", "/"},
+		{"https://evil.example/", "/"},
+		{"/\tevil.example", "/"},
+		{"/%2F/evil.example", "/"},
+	}
+	for _, tt := range tests {
+		if got := localPath(tt.back); got != tt.want {
+			t.Errorf("localPath(%q) = %q, want %q", tt.back, got, tt.want)
+		}
+	}
+}
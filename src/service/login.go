@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"otus-hiload/src/logger"
+	"otus-hiload/src/repository"
+)
+
+// authenticate checks the password unless the login or the ip has to wait after recent failures or for the attempts
+// in flight.
+// Failed attempts are audited, the attempts rejected while waiting are only logged: they cost the attacker nothing
+// and must not cost a database write.
+func (s *userService) authenticate(ctx context.Context, login string, password string, ip string) (*repository.User, error) {
+	key := repository.NormalizeLogin(login)
+	if wait := s.loginGuard.Reserve(key, ip); wait > 0 {
+		logger.FromContext(ctx).Info("login throttled", "login", key, "ip", ip, "wait", wait.String())
+		return nil, tooManyRequests("login.throttled", wait)
+	}
+
+	user, err := s.UserRepository.FindByLoginAndPassword(ctx, login, password)
+	if err == nil {
+		s.loginGuard.Succeed(key, ip)
+		// checked after the password, the form must not tell a guesser which accounts are blocked
+		if user.BlockedAt.Valid {
+			s.audit(ctx, &repository.AuditEntry{Action: repository.AuditLoginBlocked, UserID: auditUser(user.ID),
+				Login: key, IP: ip})
+			return nil, forbidden("login.blocked")
+		}
+		return user, nil
+	}
+	if !errors.Is(err, repository.ErrInvalidCredentials) {
+		s.loginGuard.Release(key, ip)
+		return nil, err
+	}
+
+	failure := s.loginGuard.Fail(key, ip)
+	s.audit(ctx, &repository.AuditEntry{Action: repository.AuditLoginFailed, Login: key, IP: ip})
+	if failure.LoginLocked || failure.IPLocked {
+		details := "login"
+		if failure.IPLocked {
+			details = "ip"
+		}
+		logger.FromContext(ctx).Info("login locked", "login", key, "ip", ip, "locked", details, "wait", failure.Wait.String())
+		s.audit(ctx, &repository.AuditEntry{Action: repository.AuditLoginLocked, Login: key, IP: ip, Details: details})
+	}
+	return nil, err
+}
+
+// audit writes the entry, a failed write is logged and does not fail the request
+func (s *userService) audit(ctx context.Context, entry *repository.AuditEntry) {
+	err := s.AuditRepository.AddAuditEntry(ctx, entry)
+	s.logError(ctx, "audit "+entry.Action, err)
+}
+
+// auditUser is the user id of the audit entry
+func auditUser(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: true}
+}
@@ -1,14 +1,19 @@
 package service
 
 import (
-	"errors"
 	"github.com/gorilla/mux"
 	"html"
-	"log"
 	"net/http"
 	"otus-hiload/src/constants"
+	"otus-hiload/src/logger"
+	"otus-hiload/src/repository"
+	"otus-hiload/src/validation"
 	"strconv"
-	"unicode/utf8"
+)
+
+const (
+	minDescriptionLength  = 20
+	minSearchPrefixLength = 3
 )
 
 type IPageService interface {
@@ -22,46 +27,49 @@ type IPageService interface {
 func (s *userService) EditHandler(w http.ResponseWriter, r *http.Request) {
 	user, err := s.getUserFromContext(r.Context())
 	if err != nil {
-		s.logError("EditHandler getUserFromContext", err)
-		http.Redirect(w, r, constants.RootPath, http.StatusFound)
+		s.renderError(w, r, err)
+		return
 	}
 
 	if r.Method == "GET" {
-		s.renderForm(w, "edit", nil)
+		s.renderForm(w, r, "edit", nil)
 	}
 
 	if r.Method == "POST" {
-		// max 10 MB
-		err := r.ParseMultipartForm(10 << 20)
+		// the photo and the form fields, larger bodies fail to parse; a no-op if the CSRF middleware parsed the form
+		r.Body = http.MaxBytesReader(w, r.Body, maxPhotoSize+1<<20)
+		err := r.ParseMultipartForm(maxPhotoSize)
 		if err != nil {
-			s.logError("EditHandler ParseMultipartForm", err)
-			s.renderForm(w, "edit", errors.New("ошибка обработки формы"))
+			s.logError(r.Context(), "EditHandler ParseMultipartForm", err)
+			s.renderForm(w, r, "edit", badRequest("edit.form_parse"))
 			return
 		}
 
-		description := r.FormValue("descr")
-		if len(description) < 20 {
-			s.renderForm(w, "edit", errors.New("заполните описание (не менее 20 символов)"))
-			return
-		}
-		description = html.EscapeString(description)
+		form := &profileForm{Description: r.FormValue("descr")}
+		params := make(map[string]interface{})
+		params["description"] = form.Description
 
+		var v validation.Validator
+		form.validate(&v)
 		file, header, err := r.FormFile("photo")
 		if err != nil {
-			s.logError("EditHandler formFile", err)
-			s.renderForm(w, "edit", errors.New("не выбран файл фото"))
+			v.Add("photo", validation.Violation{Key: "validation.required"})
+		} else {
+			defer file.Close()
+			v.CheckFile("photo", file, header, maxPhotoSize, photoTypes...)
+		}
+		if err := v.Err(); err != nil {
+			s.renderFormError(w, r, "edit", params, err)
 			return
 		}
-		defer file.Close()
+		description := html.EscapeString(form.Description)
 
-		log.Printf("Uploaded File: %+v\n", header.Filename)
-		log.Printf("File Size: %+v\n", header.Size)
-		log.Printf("MIME Header: %+v\n", header.Header)
+		logger.FromContext(r.Context()).Info("photo uploaded", "file_name", header.Filename, "size", header.Size)
 
-		fName, err := s.storage.SaveFile(file, header.Filename)
+		fName, err := s.storage.SaveFile(r.Context(), file, header.Filename)
 		if err != nil {
-			s.logError("saveFile", err)
-			s.renderForm(w, "edit", errors.New("ошибка загрузки файла"))
+			s.logError(r.Context(), "saveFile", err)
+			s.renderForm(w, r, "edit", badRequest("edit.upload_failed"))
 			return
 		}
 
@@ -69,15 +77,14 @@ func (s *userService) EditHandler(w http.ResponseWriter, r *http.Request) {
 
 		user.Description = description
 		user.PhotoFile = fName
-		err = s.UserRepository.Update(user)
+		err = s.UserRepository.Update(r.Context(), user)
 		if err != nil {
-			s.storage.DeleteFile(fName)
-			s.logError("EditHandler UpdateUser", err)
-			s.renderForm(w, "edit", errors.New("внутренняя ошибка сервера"))
+			s.storage.DeleteFile(r.Context(), fName)
+			s.renderForm(w, r, "edit", err)
 			return
 		}
 
-		s.storage.DeleteFile(oldFile)
+		s.storage.DeleteFile(r.Context(), oldFile)
 		http.Redirect(w, r, constants.MePath, http.StatusFound)
 	}
 }
@@ -85,22 +92,22 @@ func (s *userService) EditHandler(w http.ResponseWriter, r *http.Request) {
 func (s *userService) MeHandler(w http.ResponseWriter, r *http.Request) {
 	user, err := s.getUserFromContext(r.Context())
 	if err != nil {
-		s.logError("MeHandler getUserFromContext", err)
-		http.Redirect(w, r, constants.RootPath, http.StatusFound)
+		s.renderError(w, r, err)
+		return
 	}
 
 	if len(user.Description) == 0 {
-		log.Printf("user has no description, go to edit")
 		http.Redirect(w, r, constants.MeEditPath, http.StatusFound)
+		return
 	}
 
-	params := make(map[string]string)
+	params := make(map[string]interface{})
 	params["description"] = user.Description
 	params["name"] = user.Name
 	params["last_name"] = user.LastName
 	params["image"] = user.PhotoFile
 
-	s.renderFormParams(w, "me", params)
+	s.renderFormParams(w, r, "me", params)
 }
 
 func (s *userService) UserHandler(w http.ResponseWriter, r *http.Request) {
@@ -108,43 +115,42 @@ func (s *userService) UserHandler(w http.ResponseWriter, r *http.Request) {
 	idStr := vars["id"]
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		s.logError("UserHandler parseInt", err)
-		http.Redirect(w, r, constants.RootPath, http.StatusFound)
+		s.logError(r.Context(), "UserHandler parseInt", err)
+		s.renderError(w, r, repository.ErrNotFound)
+		return
 	}
 
-	user, err := s.UserRepository.Get(id)
+	user, err := s.UserRepository.Get(r.Context(), id)
 	if err != nil {
-		s.logError("UserHandler UserRepository.Get", err)
-		http.Redirect(w, r, constants.RootPath, http.StatusFound)
+		s.renderError(w, r, err)
+		return
 	}
 
-	params := make(map[string]string)
+	params := make(map[string]interface{})
 	params["description"] = user.Description
 	params["name"] = user.Name
 	params["last_name"] = user.LastName
 	params["image"] = user.PhotoFile
 
-	s.renderFormParams(w, "user", params)
+	s.renderFormParams(w, r, "user", params)
 }
 
 func (s *userService) RootHandler(w http.ResponseWriter, r *http.Request) {
 	user, err := s.getUserFromContext(r.Context())
 	params := make(map[string]interface{})
 	if err != nil {
-		s.logError("RootHandler getUserFromContext", err)
-		s.renderForm(w, "root", errors.New("внутренняя ошибка сервера"))
+		s.renderError(w, r, err)
 		return
 	}
 
-	users, err := s.UserRepository.GetAll()
+	users, err := s.UserRepository.GetAll(r.Context())
 	if err != nil {
-		s.logError("UserRepository.GetAll", err)
-		s.renderForm(w, "root", errors.New("внутренняя ошибка сервера"))
+		s.renderError(w, r, err)
 		return
 	}
 	params["users"] = users
 	params["myId"] = user.ID
-	s.renderFormParams(w, "root", params)
+	s.renderFormParams(w, r, "root", params)
 }
 
 func (s *userService) SearchHandler(w http.ResponseWriter, r *http.Request) {
@@ -152,7 +158,7 @@ func (s *userService) SearchHandler(w http.ResponseWriter, r *http.Request) {
 	prefix := queryValues.Get("prefix")
 
 	if len(prefix) == 0 {
-		s.renderForm(w, "search", nil)
+		s.renderForm(w, r, "search", nil)
 		return
 	}
 
@@ -160,18 +166,18 @@ func (s *userService) SearchHandler(w http.ResponseWriter, r *http.Request) {
 	params := make(map[string]interface{})
 	params["prefix"] = prefix
 
-	if utf8.RuneCountInString(prefix) < 3 {
-		params["error"] = "Минимальная длина префикса - 3 символа"
-		s.renderFormParams(w, "search", params)
+	var v validation.Validator
+	v.Check("prefix", prefix, validation.MinRunes(minSearchPrefixLength))
+	if err := v.Err(); err != nil {
+		s.renderFormError(w, r, "search", params, err)
 		return
 	}
 
 	fromID, _ := strconv.ParseInt(queryValues.Get("minId"), 10, 64)
 
-	users, err := s.UserRepository.FindByNamePrefix(prefix, s.searchPageSize+1, fromID)
+	users, err := s.UserRepository.FindByNamePrefix(r.Context(), prefix, s.searchPageSize+1, fromID)
 	if err != nil {
-		s.logError("UserRepository.FindByNamePrefix", err)
-		s.renderForm(w, "search", errors.New("внутренняя ошибка сервера"))
+		s.renderFormError(w, r, "search", params, err)
 		return
 	}
 
@@ -187,5 +193,5 @@ func (s *userService) SearchHandler(w http.ResponseWriter, r *http.Request) {
 	params["hasNext"] = hasNext
 	params["minId"] = minID
 
-	s.renderFormParams(w, "search", params)
+	s.renderFormParams(w, r, "search", params)
 }
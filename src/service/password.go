@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"otus-hiload/src/constants"
+	"otus-hiload/src/i18n"
+	"otus-hiload/src/logger"
+	"otus-hiload/src/middleware"
+	"otus-hiload/src/notify"
+	"otus-hiload/src/repository"
+	"otus-hiload/src/validation"
+	"time"
+)
+
+// PasswordResetOptions configure the password reset flow: the link to BaseURL is sent by the Notifier
+// and is valid for TTL
+type PasswordResetOptions struct {
+	Notifier notify.Notifier
+	TTL      time.Duration
+	BaseURL  string
+}
+
+type IPasswordService interface {
+	PasswordHandler(w http.ResponseWriter, r *http.Request)
+	PasswordResetHandler(w http.ResponseWriter, r *http.Request)
+	PasswordResetConfirmHandler(w http.ResponseWriter, r *http.Request)
+	RunPasswordResets(stop <-chan struct{})
+}
+
+const (
+	resetTokenSize = 32
+	// resetQueueSize is the number of the reset requests waiting for the worker
+	resetQueueSize = 100
+	// resetTimeout limits the lookup and the delivery of one reset link
+	resetTimeout = time.Minute
+)
+
+// passwordResetRequest is handled by the worker after the response is sent
+type passwordResetRequest struct {
+	login  string
+	ip     string
+	logger *logger.Logger
+	locale *i18n.Localizer
+}
+
+// PasswordHandler changes the password of the current user, the other sessions of the user are signed out
+func (s *userService) PasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" {
+		s.renderForm(w, r, "password", nil)
+		return
+	}
+
+	user, err := s.getUserFromContext(r.Context())
+	if err != nil {
+		s.renderError(w, r, err)
+		return
+	}
+
+	oldPassword := r.PostFormValue("old_password")
+	password := r.PostFormValue("password")
+	var v validation.Validator
+	v.Check("old_password", oldPassword, validation.Required())
+	checkNewPassword(&v, password, r.PostFormValue("password_confirm"))
+	if err := v.Err(); err != nil {
+		s.renderForm(w, r, "password", err)
+		return
+	}
+
+	// the old password is checked like a login, guessing it is throttled the same way
+	_, err = s.authenticate(r.Context(), user.Login, oldPassword, middleware.ClientIP(r))
+	if errors.Is(err, repository.ErrInvalidCredentials) {
+		v.Add("old_password", validation.Violation{Key: "password.old_invalid"})
+		err = v.Err()
+	}
+	if err != nil {
+		s.renderForm(w, r, "password", err)
+		return
+	}
+
+	user.Password = password
+	if err := s.PasswordRepository.UpdatePassword(r.Context(), user); err != nil {
+		s.renderForm(w, r, "password", err)
+		return
+	}
+	s.audit(r.Context(), &repository.AuditEntry{Action: repository.AuditPasswordChanged, UserID: auditUser(user.ID),
+		Login: user.Login, IP: middleware.ClientIP(r)})
+
+	// the current session moves to the new session version, the others are deleted from the store right away.
+	// If that fails, the session version still signs them out on their next request.
+	if err := s.setAuthenticated(r.Context(), user); err != nil {
+		s.renderForm(w, r, "password", err)
+		return
+	}
+	_, err = s.sessions.RevokeAll(r.Context(), user.ID, s.sessions.ID(r.Context()))
+	s.logError(r.Context(), "password change revoke sessions", err)
+	http.Redirect(w, r, constants.MePath, http.StatusFound)
+}
+
+// PasswordResetHandler queues the reset link. The login is looked up and the link is sent by the worker, so the
+// request does the same work and takes the same time whether the login exists or not, and the form can not be used
+// to find out the logins.
+func (s *userService) PasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" {
+		s.renderForm(w, r, "reset", nil)
+		return
+	}
+
+	login := r.PostFormValue("login")
+	params := make(map[string]interface{})
+	params["login"] = login
+
+	var v validation.Validator
+	v.Check("login", login, validation.Required())
+	if err := v.Err(); err != nil {
+		s.renderFormError(w, r, "reset", params, err)
+		return
+	}
+
+	req := passwordResetRequest{login: login, ip: middleware.ClientIP(r), logger: logger.FromContext(r.Context()),
+		locale: i18n.FromContext(r.Context())}
+	select {
+	case s.passwordResets <- req:
+	default:
+		// the queue does not depend on the login, telling that it is full leaks nothing
+		s.renderFormError(w, r, "reset", params, unavailable("error.overloaded"))
+		return
+	}
+	params["sent"] = true
+	s.renderFormParams(w, r, "reset", params)
+}
+
+// RunPasswordResets sends the queued reset links until stop is closed, the links queued by then are still sent
+func (s *userService) RunPasswordResets(stop <-chan struct{}) {
+	for {
+		select {
+		case req := <-s.passwordResets:
+			s.handlePasswordReset(req)
+		case <-stop:
+			for {
+				select {
+				case req := <-s.passwordResets:
+					s.handlePasswordReset(req)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// handlePasswordReset runs in the worker with the logger and the locale of the request but not its deadline
+func (s *userService) handlePasswordReset(req passwordResetRequest) {
+	ctx := i18n.WithContext(logger.WithContext(context.Background(), req.logger), req.locale)
+	ctx, cancel := context.WithTimeout(ctx, resetTimeout)
+	defer cancel()
+
+	err := s.sendPasswordReset(ctx, req.login, req.ip)
+	s.logError(ctx, "password reset", err)
+}
+
+func (s *userService) sendPasswordReset(ctx context.Context, login string, ip string) error {
+	user, err := s.UserRepository.GetByLogin(ctx, login)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(user.Email) == 0 {
+		logger.FromContext(ctx).Info("password reset without email", "user_id", user.ID)
+		return nil
+	}
+
+	b := make([]byte, resetTokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	if err := s.PasswordRepository.CreatePasswordReset(ctx, user.ID, tokenHash(token), s.passwordReset.TTL); err != nil {
+		return err
+	}
+	s.audit(ctx, &repository.AuditEntry{Action: repository.AuditPasswordResetRequested, UserID: auditUser(user.ID),
+		Login: user.Login, IP: ip})
+
+	l := i18n.FromContext(ctx)
+	link := s.passwordReset.BaseURL + constants.PasswordResetConfirmPath + "?token=" + url.QueryEscape(token)
+	err = s.passwordReset.Notifier.Notify(ctx, &notify.Message{
+		To:      user.Email,
+		Subject: l.T("reset.mail_subject"),
+		Body:    l.T("reset.mail_body", user.Name, link, int(s.passwordReset.TTL/time.Minute)),
+	})
+	s.logError(ctx, "password reset notify", err)
+	return nil
+}
+
+// PasswordResetConfirmHandler sets the new password by the token of the reset link
+func (s *userService) PasswordResetConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	// the token is in the url, it must not leak to other sites in the Referer
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	params := make(map[string]interface{})
+	if r.Method == "GET" {
+		params["token"] = r.URL.Query().Get("token")
+		s.renderFormParams(w, r, "reset_confirm", params)
+		return
+	}
+
+	token := r.PostFormValue("token")
+	password := r.PostFormValue("password")
+	params["token"] = token
+
+	var v validation.Validator
+	checkNewPassword(&v, password, r.PostFormValue("password_confirm"))
+	if err := v.Err(); err != nil {
+		s.renderFormError(w, r, "reset_confirm", params, err)
+		return
+	}
+
+	userID, err := s.PasswordRepository.ResetPassword(r.Context(), tokenHash(token), password)
+	if errors.Is(err, repository.ErrNotFound) {
+		err = badRequest("reset.invalid_token")
+	}
+	if err != nil {
+		s.renderFormError(w, r, "reset_confirm", params, err)
+		return
+	}
+	s.audit(r.Context(), &repository.AuditEntry{Action: repository.AuditPasswordReset, UserID: auditUser(userID),
+		IP: middleware.ClientIP(r)})
+	_, err = s.sessions.RevokeAll(r.Context(), userID, "")
+	s.logError(r.Context(), "password reset revoke sessions", err)
+
+	params = make(map[string]interface{})
+	params["info"] = i18n.FromContext(r.Context()).T("reset.done")
+	s.renderFormParams(w, r, "login", params)
+}
+
+// tokenHash is stored instead of the secret tokens, the reset links and the recovery codes:
+// a leaked table does not give working ones
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"otus-hiload/src/constants"
+	"otus-hiload/src/middleware"
+	"otus-hiload/src/repository"
+	"strconv"
+)
+
+type ISessionsService interface {
+	SessionsHandler(w http.ResponseWriter, r *http.Request)
+}
+
+// SessionsHandler lists the sessions of the current user and signs out one of them or all the others
+func (s *userService) SessionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := s.getUserFromContext(ctx)
+	if err != nil {
+		s.renderError(w, r, err)
+		return
+	}
+	currentID := s.sessions.ID(ctx)
+
+	if r.Method == "POST" {
+		entry := &repository.AuditEntry{UserID: auditUser(user.ID), Login: user.Login, IP: middleware.ClientIP(r)}
+		switch r.PostFormValue("action") {
+		case "revoke":
+			id := r.PostFormValue("id")
+			if id == currentID {
+				// signing out this device is a logout
+				s.LogoutHandler(w, r)
+				return
+			}
+			err = s.sessions.Revoke(ctx, user.ID, id)
+			if errors.Is(err, repository.ErrNotFound) {
+				// already signed out or expired, the list is just stale
+				err = nil
+			} else if err == nil {
+				entry.Action = repository.AuditSessionRevoked
+				s.audit(ctx, entry)
+			}
+		case "revoke_other":
+			var n int
+			n, err = s.sessions.RevokeAll(ctx, user.ID, currentID)
+			if err == nil {
+				entry.Action = repository.AuditSessionsRevokedOther
+				entry.Details = strconv.Itoa(n)
+				s.audit(ctx, entry)
+			}
+		default:
+			err = badRequest("sessions.unknown_action")
+		}
+		if err != nil {
+			s.renderError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, constants.MeSessionsPath, http.StatusFound)
+		return
+	}
+
+	list, err := s.sessions.List(ctx, user.ID)
+	if err != nil {
+		s.renderError(w, r, err)
+		return
+	}
+	params := make(map[string]interface{})
+	params["sessions"] = list
+	params["current"] = currentID
+	s.renderFormParams(w, r, "sessions", params)
+}
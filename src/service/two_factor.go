@@ -0,0 +1,339 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"github.com/skip2/go-qrcode"
+	"html/template"
+	"net/http"
+	"otus-hiload/src/constants"
+	"otus-hiload/src/middleware"
+	"otus-hiload/src/repository"
+	"otus-hiload/src/totp"
+	"otus-hiload/src/validation"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ITwoFactorService interface {
+	TwoFactorLoginHandler(w http.ResponseWriter, r *http.Request)
+	TwoFactorHandler(w http.ResponseWriter, r *http.Request)
+}
+
+const (
+	// twoFactorTimeout is how long the second factor may be entered after the password
+	twoFactorTimeout = 5 * time.Minute
+	// totpSkew accepts the codes of the adjacent time steps, the phone clock may be off by a few seconds
+	totpSkew          = 1
+	recoveryCodeCount = 10
+	// recoveryCodeSize random bytes are 16 base32 characters
+	recoveryCodeSize = 10
+)
+
+// startTwoFactor puts the session into the half-authenticated state if the user has two-factor authentication:
+// the password is checked, the session is not authenticated until the second factor is
+func (s *userService) startTwoFactor(ctx context.Context, user *repository.User) (bool, error) {
+	_, err := s.TwoFactorRepository.GetTOTP(ctx, user.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := s.sessionManager.RenewToken(ctx); err != nil {
+		return false, err
+	}
+	s.sessionManager.Put(ctx, constants.CtxTwoFactorUserId, user.ID)
+	s.sessionManager.Put(ctx, constants.CtxTwoFactorStarted, time.Now().Unix())
+	return true, nil
+}
+
+// twoFactorUser is the user waiting for the second factor, 0 if there is none or the password check is too old
+func (s *userService) twoFactorUser(ctx context.Context) int64 {
+	userID, _ := s.sessionManager.Get(ctx, constants.CtxTwoFactorUserId).(int64)
+	started, _ := s.sessionManager.Get(ctx, constants.CtxTwoFactorStarted).(int64)
+	if time.Since(time.Unix(started, 0)) > twoFactorTimeout {
+		return 0
+	}
+	return userID
+}
+
+func (s *userService) clearTwoFactor(ctx context.Context) {
+	s.sessionManager.Remove(ctx, constants.CtxTwoFactorUserId)
+	s.sessionManager.Remove(ctx, constants.CtxTwoFactorStarted)
+}
+
+// TwoFactorLoginHandler completes the login with a TOTP code or a recovery code
+func (s *userService) TwoFactorLoginHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := s.twoFactorUser(ctx)
+	if userID == 0 {
+		s.clearTwoFactor(ctx)
+		http.Redirect(w, r, constants.LoginPath, http.StatusFound)
+		return
+	}
+	if r.Method == "GET" {
+		s.renderForm(w, r, "login_2fa", nil)
+		return
+	}
+
+	user, err := s.UserRepository.Get(ctx, userID)
+	if err == nil && user.BlockedAt.Valid {
+		// blocked between the password and the code
+		s.clearTwoFactor(ctx)
+		err = forbidden("login.blocked")
+	}
+	if err == nil {
+		err = s.checkSecondFactor(ctx, user, r.PostFormValue("code"), middleware.ClientIP(r))
+	}
+	if err != nil {
+		s.renderForm(w, r, "login_2fa", err)
+		return
+	}
+	s.clearTwoFactor(ctx)
+	if err := s.setAuthenticated(ctx, user); err != nil {
+		s.renderForm(w, r, "login_2fa", err)
+		return
+	}
+	http.Redirect(w, r, constants.MePath, http.StatusFound)
+}
+
+// checkSecondFactor accepts the current TOTP code once or an unused recovery code. The guessing is throttled
+// by its own key: a correct password resets the login counter, it must not reset the count of wrong codes.
+func (s *userService) checkSecondFactor(ctx context.Context, user *repository.User, code string, ip string) error {
+	key := "2fa:" + strconv.FormatInt(user.ID, 10)
+	if wait := s.loginGuard.Reserve(key, ip); wait > 0 {
+		return tooManyRequests("login.throttled", wait)
+	}
+
+	ok, recovery, err := s.verifySecondFactor(ctx, user.ID, code)
+	if err != nil {
+		s.loginGuard.Release(key, ip)
+		return err
+	}
+	if !ok {
+		s.loginGuard.Fail(key, ip)
+		s.audit(ctx, &repository.AuditEntry{Action: repository.AuditTwoFactorFailed, UserID: auditUser(user.ID),
+			Login: user.Login, IP: ip})
+		var v validation.Validator
+		v.Add("code", validation.Violation{Key: "2fa.invalid_code"})
+		return v.Err()
+	}
+	s.loginGuard.Succeed(key, ip)
+	if recovery {
+		// the details are the number of the codes left, the user needs new ones when they run out
+		entry := &repository.AuditEntry{Action: repository.AuditTwoFactorRecoveryUsed, UserID: auditUser(user.ID),
+			Login: user.Login, IP: ip}
+		left, err := s.TwoFactorRepository.CountRecoveryCodes(ctx, user.ID)
+		s.logError(ctx, "count recovery codes", err)
+		if err == nil {
+			entry.Details = strconv.Itoa(left)
+		}
+		s.audit(ctx, entry)
+	}
+	return nil
+}
+
+// verifySecondFactor checks the code as a TOTP code if it is 6 digits, as a recovery code otherwise
+func (s *userService) verifySecondFactor(ctx context.Context, userID int64, code string) (ok bool, recovery bool, err error) {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits && strings.Trim(code, "0123456789") == "" {
+		key, err := s.TwoFactorRepository.GetTOTP(ctx, userID)
+		if err != nil {
+			return false, false, err
+		}
+		step, valid := totp.Validate(key.Secret, code, time.Now(), totpSkew)
+		if !valid {
+			return false, false, nil
+		}
+		// a code seen by someone else is useless after it was used once
+		ok, err := s.TwoFactorRepository.UseTOTPStep(ctx, userID, step)
+		return ok, false, err
+	}
+
+	normalized := normalizeRecoveryCode(code)
+	if len(normalized) == 0 {
+		return false, true, nil
+	}
+	ok, err = s.TwoFactorRepository.UseRecoveryCode(ctx, userID, tokenHash(normalized))
+	return ok, true, err
+}
+
+// TwoFactorHandler shows the two-factor authentication of the current user, enrolls and disables it
+func (s *userService) TwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := s.getUserFromContext(ctx)
+	if err != nil {
+		s.renderError(w, r, err)
+		return
+	}
+
+	if r.Method == "POST" {
+		switch r.PostFormValue("action") {
+		case "start":
+			if _, err := s.TwoFactorRepository.GetTOTP(ctx, user.ID); err == nil {
+				// already enabled, the form was sent twice
+				http.Redirect(w, r, constants.MeTwoFactorPath, http.StatusFound)
+				return
+			}
+			secret, err := totp.NewSecret()
+			if err != nil {
+				s.renderError(w, r, err)
+				return
+			}
+			s.sessionManager.Put(ctx, constants.CtxTOTPEnrollSecret, secret)
+			s.renderEnrollment(w, r, user, secret, nil)
+		case "confirm":
+			s.confirmTwoFactor(w, r, user)
+		case "disable":
+			s.disableTwoFactor(w, r, user)
+		default:
+			s.renderError(w, r, badRequest("2fa.unknown_action"))
+		}
+		return
+	}
+
+	params := make(map[string]interface{})
+	if err := s.twoFactorStatus(ctx, user, params); err != nil {
+		s.renderError(w, r, err)
+		return
+	}
+	s.renderFormParams(w, r, "two_factor", params)
+}
+
+// disableTwoFactor turns the second factor off after checking the password again: a session left open
+// on a shared computer must not be enough for that
+func (s *userService) disableTwoFactor(w http.ResponseWriter, r *http.Request, user *repository.User) {
+	ctx := r.Context()
+	password := r.PostFormValue("password")
+	var v validation.Validator
+	v.Check("password", password, validation.Required())
+	err := v.Err()
+	if err == nil {
+		_, err = s.authenticate(ctx, user.Login, password, middleware.ClientIP(r))
+		if errors.Is(err, repository.ErrInvalidCredentials) {
+			v.Add("password", validation.Violation{Key: "password.old_invalid"})
+			err = v.Err()
+		}
+	}
+	if err == nil {
+		err = s.TwoFactorRepository.DisableTOTP(ctx, user.ID)
+	}
+	if err != nil {
+		s.renderTwoFactorError(w, r, user, err)
+		return
+	}
+	s.audit(ctx, &repository.AuditEntry{Action: repository.AuditTwoFactorDisabled, UserID: auditUser(user.ID),
+		Login: user.Login, IP: middleware.ClientIP(r)})
+	http.Redirect(w, r, constants.MeTwoFactorPath, http.StatusFound)
+}
+
+// confirmTwoFactor enables the enrolled secret once the user shows a code of it, the recovery codes are shown once
+func (s *userService) confirmTwoFactor(w http.ResponseWriter, r *http.Request, user *repository.User) {
+	ctx := r.Context()
+	secret := s.sessionManager.GetString(ctx, constants.CtxTOTPEnrollSecret)
+	if len(secret) == 0 {
+		http.Redirect(w, r, constants.MeTwoFactorPath, http.StatusFound)
+		return
+	}
+	step, ok := totp.Validate(secret, strings.TrimSpace(r.PostFormValue("code")), time.Now(), totpSkew)
+	if !ok {
+		var v validation.Validator
+		v.Add("code", validation.Violation{Key: "2fa.invalid_code"})
+		s.renderEnrollment(w, r, user, secret, v.Err())
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err == nil {
+		err = s.TwoFactorRepository.EnableTOTP(ctx, user.ID, secret, step, hashes)
+	}
+	if err != nil {
+		s.renderEnrollment(w, r, user, secret, err)
+		return
+	}
+	s.sessionManager.Remove(ctx, constants.CtxTOTPEnrollSecret)
+	s.audit(ctx, &repository.AuditEntry{Action: repository.AuditTwoFactorEnabled, UserID: auditUser(user.ID),
+		Login: user.Login, IP: middleware.ClientIP(r)})
+
+	params := make(map[string]interface{})
+	params["enabled"] = true
+	params["recovery_left"] = len(codes)
+	params["codes"] = codes
+	s.renderFormParams(w, r, "two_factor", params)
+}
+
+func (s *userService) twoFactorStatus(ctx context.Context, user *repository.User, params map[string]interface{}) error {
+	_, err := s.TwoFactorRepository.GetTOTP(ctx, user.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		params["enabled"] = false
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	left, err := s.TwoFactorRepository.CountRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	params["enabled"] = true
+	params["recovery_left"] = left
+	return nil
+}
+
+func (s *userService) renderTwoFactorError(w http.ResponseWriter, r *http.Request, user *repository.User, err error) {
+	params := make(map[string]interface{})
+	if statusErr := s.twoFactorStatus(r.Context(), user, params); statusErr != nil {
+		s.renderError(w, r, statusErr)
+		return
+	}
+	s.renderFormError(w, r, "two_factor", params, err)
+}
+
+// renderEnrollment shows the secret as a QR code of the otpauth URI and as text for typing it in
+func (s *userService) renderEnrollment(w http.ResponseWriter, r *http.Request, user *repository.User, secret string,
+	err error) {
+	params := make(map[string]interface{})
+	uri := totp.URI(constants.TOTPIssuer, user.Login, secret)
+	params["enabled"] = false
+	params["enrolling"] = true
+	params["secret"] = secret
+	params["uri"] = uri
+	png, qrErr := qrcode.Encode(uri, qrcode.Medium, 256)
+	if qrErr != nil {
+		// the text form still works, an overlong login does not fit the QR code
+		s.logError(r.Context(), "totp qr code", qrErr)
+	} else {
+		params["qr"] = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+	}
+	if err != nil {
+		s.renderFormError(w, r, "two_factor", params, err)
+		return
+	}
+	s.renderFormParams(w, r, "two_factor", params)
+}
+
+// newRecoveryCodes returns the codes shown to the user, XXXX-XXXX-XXXX-XXXX, and the hashes stored for them
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	b := make([]byte, recoveryCodeSize)
+	for i := range codes {
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := base32.StdEncoding.EncodeToString(b)
+		codes[i] = raw[0:4] + "-" + raw[4:8] + "-" + raw[8:12] + "-" + raw[12:16]
+		hashes[i] = tokenHash(raw)
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode accepts the code in any case, with or without the dashes and spaces
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToUpper(code))
+}
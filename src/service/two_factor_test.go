@@ -0,0 +1,50 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"ABCD-EFGH-IJKL-MNOP", "ABCDEFGHIJKLMNOP"},
+		{"abcd-efgh-ijkl-mnop", "ABCDEFGHIJKLMNOP"},
+		{"ABCDEFGHIJKLMNOP", "ABCDEFGHIJKLMNOP"},
+		{"ABCD EFGH IJKL MNOP", "ABCDEFGHIJKLMNOP"},
+		{" abcd-EFGH ijkl-mnop ", "ABCDEFGHIJKLMNOP"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeRecoveryCode(tt.code); got != tt.want {
+			t.Errorf("normalizeRecoveryCode(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+// TestRecoveryCodes checks that a code shown to the user matches its stored hash after normalization
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatalf("newRecoveryCodes() error = %v", err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), len(hashes), recoveryCodeCount)
+	}
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		parts := strings.Split(code, "-")
+		if len(parts) != 4 || len(code) != 19 {
+			t.Errorf("code %q, want XXXX-XXXX-XXXX-XXXX", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q repeated", code)
+		}
+		seen[code] = true
+		if got := tokenHash(normalizeRecoveryCode(strings.ToLower(code))); got != hashes[i] {
+			t.Errorf("hash of the normalized code %q does not match the stored one", code)
+		}
+	}
+}
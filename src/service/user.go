@@ -1,62 +1,91 @@
 package service
 
 import (
-	"errors"
-	"fmt"
 	"github.com/alexedwards/scs/v2"
 	"net/http"
 	"otus-hiload/src/constants"
 	"otus-hiload/src/file_storage"
+	"otus-hiload/src/middleware"
 	"otus-hiload/src/repository"
+	"otus-hiload/src/sessions"
+	"otus-hiload/src/throttle"
+	"otus-hiload/src/view"
 )
 
 type userService struct {
-	UserRepository repository.IUserRepository
-	sessionManager *scs.SessionManager
-	storage        file_storage.IFileStorage
-	searchPageSize int
+	UserRepository      repository.IUserRepository
+	PasswordRepository  repository.IPasswordRepository
+	AuditRepository     repository.IAuditRepository
+	TwoFactorRepository repository.ITwoFactorRepository
+	AdminRepository     repository.IAdminRepository
+	sessionManager      *scs.SessionManager
+	storage             file_storage.IFileStorage
+	searchPageSize      int
+	templates           *view.Set
+	loginGuard          *throttle.LoginGuard
+	passwordReset       PasswordResetOptions
+	passwordResets      chan passwordResetRequest
+	sessions            *sessions.Registry
 }
 
 type IUserService interface {
 	LoginHandler(w http.ResponseWriter, r *http.Request)
 	LogoutHandler(w http.ResponseWriter, r *http.Request)
 	RegHandler(w http.ResponseWriter, r *http.Request)
+	LocaleHandler(w http.ResponseWriter, r *http.Request)
 	IPageService
+	IPasswordService
+	ISessionsService
+	ITwoFactorService
+	IAdminService
+	IAPIService
 }
 
-func NewUserService(repository repository.IUserRepository, sessionManager *scs.SessionManager,
-	storage file_storage.IFileStorage) IUserService {
-	return &userService{UserRepository: repository, sessionManager: sessionManager, storage: storage, searchPageSize: 1000}
+func NewUserService(repository repository.IRepository, sessionManager *scs.SessionManager,
+	storage file_storage.IFileStorage, templates *view.Set, loginGuard *throttle.LoginGuard,
+	passwordReset PasswordResetOptions, sessions *sessions.Registry) IUserService {
+	return &userService{UserRepository: repository, PasswordRepository: repository, AuditRepository: repository,
+		TwoFactorRepository: repository, AdminRepository: repository, sessionManager: sessionManager, storage: storage, searchPageSize: 1000, templates: templates,
+		loginGuard: loginGuard, passwordReset: passwordReset, passwordResets: make(chan passwordResetRequest, resetQueueSize),
+		sessions: sessions}
 }
 
 func (s *userService) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "GET" {
-		s.renderForm(w, "login", nil)
+		s.renderForm(w, r, "login", nil)
 	}
 
 	if r.Method == "POST" {
 		err := r.ParseForm()
-		s.logError("login form parse error: %s", err)
+		s.logError(r.Context(), "login form parse", err)
 
 		login := r.FormValue("login")
 		password := r.FormValue("password")
 
 		if len(login) == 0 || len(password) == 0 {
-			s.renderForm(w, "login", errors.New("все поля должны быть заполнены"))
+			s.renderForm(w, r, "login", badRequest("form.required_fields"))
 			return
 		}
 
-		user, err := s.UserRepository.FindByLoginAndPassword(login, password)
+		user, err := s.authenticate(r.Context(), login, password, middleware.ClientIP(r))
 		if err != nil {
-			s.logError("UserRepository.FindByLoginAndPassword error: %s", err)
-			s.renderForm(w, "login", errors.New("комбинация логин/пароль не существует"))
+			s.renderForm(w, r, "login", err)
+			return
+		}
+		// with the second factor enabled the password only lets the user to the code form
+		pending, err := s.startTwoFactor(r.Context(), user)
+		if err != nil {
+			s.renderForm(w, r, "login", err)
+			return
+		}
+		if pending {
+			http.Redirect(w, r, constants.LoginTwoFactorPath, http.StatusFound)
 			return
 		}
 		//
 		err = s.setAuthenticated(r.Context(), user)
 		if err != nil {
-			s.logError("sessionManager.RenewToken error: %s", err)
-			s.renderForm(w, "login", errors.New("внутренняя ошибка сервера"))
+			s.renderForm(w, r, "login", err)
 			return
 		}
 		//
@@ -66,60 +95,37 @@ func (s *userService) LoginHandler(w http.ResponseWriter, r *http.Request) {
 
 func (s *userService) RegHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "GET" {
-		s.renderForm(w, "reg", nil)
+		s.renderForm(w, r, "reg", nil)
 	}
 
 	if r.Method == "POST" {
 		err := r.ParseForm()
-		s.logError("reg form parse error: %s", err)
-
-		login := r.FormValue("login")
-		name := r.FormValue("name")
-		lastName := r.FormValue("last_name")
-		password := r.FormValue("password")
-		passwordConfirm := r.FormValue("password2")
-
-		params := make(map[string]string)
-		params["login"] = login
-		params["name"] = name
-		params["last_name"] = lastName
-
-		if len(login) == 0 || len(name) == 0 || len(lastName) == 0 || len(password) == 0 || len(passwordConfirm) == 0 {
-			params["error"] = "все поля должны быть заполнены"
-			s.renderFormParams(w, "reg", params)
-			return
-		}
-
-		if password != passwordConfirm {
-			params["error"] = "пароль должен быть равен подтверждению"
-			s.renderFormParams(w, "reg", params)
-			return
+		s.logError(r.Context(), "reg form parse", err)
+
+		form := &registrationForm{
+			Login:           r.FormValue("login"),
+			Name:            r.FormValue("name"),
+			LastName:        r.FormValue("last_name"),
+			Email:           r.FormValue("email"),
+			Password:        r.FormValue("password"),
+			PasswordConfirm: r.FormValue("password_confirm"),
 		}
 
-		if s.UserRepository.IsLoginExist(login) {
-			params["error"] = fmt.Sprintf("логин пользователя [%s] уже занят", login)
-			s.renderFormParams(w, "reg", params)
-			return
-		}
+		params := make(map[string]interface{})
+		params["login"] = form.Login
+		params["name"] = form.Name
+		params["last_name"] = form.LastName
+		params["email"] = form.Email
 
-		user := new(repository.User)
-		user.Login = login
-		user.Name = name
-		user.LastName = lastName
-		user.Password = password
-		err = s.UserRepository.Create(user)
-		s.logError("UserRepository.Create error: %s", err)
+		user, err := s.register(r.Context(), form)
 		if err != nil {
-			params["error"] = "внутренняя ошибка сервера"
-			s.renderFormParams(w, "reg", params)
+			s.renderFormError(w, r, "reg", params, err)
 			return
 		}
 		//
 		err = s.setAuthenticated(r.Context(), user)
-		s.logError("sessionManager.RenewToken error: %s", err)
 		if err != nil {
-			params["error"] = "внутренняя ошибка сервера"
-			s.renderFormParams(w, "reg", params)
+			s.renderFormError(w, r, "reg", params, err)
 			return
 		}
 		http.Redirect(w, r, constants.MePath, http.StatusFound)
@@ -128,6 +134,6 @@ func (s *userService) RegHandler(w http.ResponseWriter, r *http.Request) {
 
 func (s *userService) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	err := s.setUnauthenticated(r.Context())
-	s.logError("setUnauthenticated", err)
+	s.logError(r.Context(), "setUnauthenticated", err)
 	http.Redirect(w, r, constants.RootPath, http.StatusFound)
 }
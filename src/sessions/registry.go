@@ -0,0 +1,200 @@
+package sessions
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"github.com/alexedwards/scs/v2"
+	"net/http"
+	"otus-hiload/src/constants"
+	"otus-hiload/src/logger"
+	"otus-hiload/src/middleware"
+	"otus-hiload/src/repository"
+	"time"
+)
+
+const idSize = 32
+
+// Registry keeps the list of the authenticated sessions of every user. The session store is keyed by tokens that
+// change on every renewal, so the session gets its own id at login: the id is kept in the session data,
+// the registry maps it to the current token, which is what revocation deletes from the store.
+type Registry struct {
+	sessionManager *scs.SessionManager
+	repo           repository.ISessionRepository
+	touchInterval  time.Duration
+	// checkEveryRequest is set for the cookie sessions: revoking one can not delete it from the store,
+	// so it is looked up on every request instead of every touch
+	checkEveryRequest bool
+}
+
+// NewRegistry stores the last seen time of a session at most once per touchInterval
+func NewRegistry(sessionManager *scs.SessionManager, repo repository.ISessionRepository, touchInterval time.Duration) *Registry {
+	_, inCookie := sessionManager.Store.(middleware.SessionCookieEncoder)
+	return &Registry{sessionManager: sessionManager, repo: repo, touchInterval: touchInterval, checkEveryRequest: inCookie}
+}
+
+// Start registers the session at login. The session must be renewed before, the row is saved
+// with the new token by TokenHandler. A session that already has an id, e.g. on a password change, keeps it.
+func (g *Registry) Start(ctx context.Context) error {
+	if len(g.ID(ctx)) == 0 {
+		id, err := newID()
+		if err != nil {
+			return err
+		}
+		g.sessionManager.Put(ctx, constants.CtxSessionID, id)
+	}
+	g.sessionManager.Put(ctx, constants.CtxSessionSeen, time.Now().Unix())
+	return nil
+}
+
+// End revokes the current session at logout, the store entry is deleted by the token renewal of the logout itself
+func (g *Registry) End(ctx context.Context) error {
+	id := g.ID(ctx)
+	userID, _ := g.sessionManager.Get(ctx, constants.CtxUserId).(int64)
+	g.sessionManager.Remove(ctx, constants.CtxSessionID)
+	g.sessionManager.Remove(ctx, constants.CtxSessionSeen)
+	if len(id) == 0 {
+		return nil
+	}
+	_, err := g.repo.RevokeSession(ctx, userID, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// ID is the id of the current session, empty if the session is not registered
+func (g *Registry) ID(ctx context.Context) string {
+	return g.sessionManager.GetString(ctx, constants.CtxSessionID)
+}
+
+// List returns the active sessions of the user
+func (g *Registry) List(ctx context.Context, userID int64) ([]*repository.UserSession, error) {
+	return g.repo.GetUserSessions(ctx, userID)
+}
+
+// Revoke signs out the session id of the user, ErrNotFound if the user has no such active session
+func (g *Registry) Revoke(ctx context.Context, userID int64, id string) error {
+	token, err := g.repo.RevokeSession(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	return g.sessionManager.Store.Delete(token)
+}
+
+// RevokeAll signs out the sessions of the user except exceptID, the empty exceptID signs out all of them.
+// It returns the number of the signed out sessions.
+func (g *Registry) RevokeAll(ctx context.Context, userID int64, exceptID string) (int, error) {
+	tokens, err := g.repo.RevokeUserSessions(ctx, userID, exceptID)
+	if err != nil {
+		return 0, err
+	}
+	for _, token := range tokens {
+		if err := g.sessionManager.Store.Delete(token); err != nil {
+			return 0, err
+		}
+	}
+	return len(tokens), nil
+}
+
+// TokenHandler saves the session with its new token, it is the middleware.SessionTokenFunc of the session handler.
+// A failed save is logged: the session is signed out on its next touch instead of failing the response.
+func (g *Registry) TokenHandler(r *http.Request, token string, expiry time.Time) {
+	ctx := r.Context()
+	id := g.ID(ctx)
+	if len(id) == 0 || !g.sessionManager.GetBool(ctx, constants.CtxAuthenticated) {
+		return
+	}
+	userID, _ := g.sessionManager.Get(ctx, constants.CtxUserId).(int64)
+	err := g.repo.SaveSession(ctx, &repository.UserSession{
+		ID:        id,
+		UserID:    userID,
+		Token:     token,
+		IP:        middleware.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		ExpiresAt: expiry,
+	})
+	if err != nil {
+		logger.FromContext(ctx).Error("session save", "error", err, "user_id", userID)
+	}
+}
+
+// Handler updates the last seen time of the authenticated sessions and signs out the revoked ones, the cookie
+// sessions are checked on every request.
+// Sessions authenticated before the registry existed are renewed into it.
+func (g *Registry) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if !g.sessionManager.GetBool(ctx, constants.CtxAuthenticated) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(g.ID(ctx)) == 0 {
+			err := g.sessionManager.RenewToken(ctx)
+			if err == nil {
+				err = g.Start(ctx)
+			}
+			if err != nil {
+				logger.FromContext(ctx).Error("session register", "error", err)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		seenUnix, _ := g.sessionManager.Get(ctx, constants.CtxSessionSeen).(int64)
+		touch := time.Since(time.Unix(seenUnix, 0)) >= g.touchInterval
+		if !touch && !g.checkEveryRequest {
+			next.ServeHTTP(w, r)
+			return
+		}
+		var active bool
+		var err error
+		if touch {
+			active, err = g.repo.TouchSession(ctx, g.ID(ctx), middleware.ClientIP(r), r.UserAgent())
+		} else {
+			active, err = g.repo.IsSessionActive(ctx, g.ID(ctx))
+		}
+		if err != nil {
+			// the registry is not worth failing the request, the check is retried on the next one
+			logger.FromContext(ctx).Error("session touch", "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !active {
+			userID, _ := g.sessionManager.Get(ctx, constants.CtxUserId).(int64)
+			logger.FromContext(ctx).Info("session signed out", "user_id", userID, "reason", "revoked")
+			if err := middleware.SignOut(ctx, g.sessionManager); err != nil {
+				logger.FromContext(ctx).Error("session renew", "error", err)
+			}
+		} else if touch {
+			g.sessionManager.Put(ctx, constants.CtxSessionSeen, time.Now().Unix())
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RunCleanup deletes the expired sessions every interval until stop is closed
+func (g *Registry) RunCleanup(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if _, err := g.repo.DeleteExpiredSessions(context.Background()); err != nil {
+				logger.Default().Error("session cleanup", "error", err)
+			}
+		}
+	}
+}
+
+func newID() (string, error) {
+	b := make([]byte, idSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,125 @@
+package sessionstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	minKeySize = 32
+	// maxCookieSize leaves room for the cookie name and attributes in the 4096 bytes browsers keep per cookie
+	maxCookieSize = 3800
+)
+
+// ErrCookieTooLarge - the session data does not fit into the cookie
+var ErrCookieTooLarge = errors.New("session cookie too large")
+
+// CookieStore keeps the session data in the cookie itself, so no store is queried per request.
+// The cookie is encrypted with AES-256-GCM: the client can neither read the session data (the CSRF token,
+// the TOTP secret during enrollment) nor change it. Nothing is kept on the server, so Delete can not invalidate
+// a cookie: a copied cookie stays valid until it expires.
+type CookieStore struct {
+	aeads []cipher.AEAD
+}
+
+// NewCookieStore encrypts with the first key and accepts the cookies encrypted with any of the keys,
+// the keys are rotated by prepending the new one
+func NewCookieStore(keys [][]byte) (*CookieStore, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("session store: cookie requires SESSION_COOKIE_KEYS")
+	}
+	s := &CookieStore{}
+	for _, key := range keys {
+		if len(key) < minKeySize {
+			return nil, fmt.Errorf("session store: cookie keys must be at least %d bytes", minKeySize)
+		}
+		// the configured keys may be longer than AES-256 takes
+		aesKey := sha256.Sum256(key)
+		block, err := aes.NewCipher(aesKey[:])
+		if err != nil {
+			return nil, fmt.Errorf("session store: %w", err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("session store: %w", err)
+		}
+		s.aeads = append(s.aeads, aead)
+	}
+	return s, nil
+}
+
+// ParseKeys decodes the comma separated base64 keys
+func ParseKeys(s string) ([][]byte, error) {
+	var keys [][]byte
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if len(part) == 0 {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(part)
+		if err != nil {
+			return nil, fmt.Errorf("session store: invalid cookie key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Find decrypts the cookie value and returns the session data, a tampered or expired cookie is not found
+func (s *CookieStore) Find(token string) ([]byte, bool, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, false, nil
+	}
+	for _, aead := range s.aeads {
+		if len(sealed) < aead.NonceSize() {
+			return nil, false, nil
+		}
+		payload, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+		if err != nil || len(payload) < 8 {
+			continue
+		}
+		expiry := time.Unix(int64(binary.BigEndian.Uint64(payload[:8])), 0)
+		if time.Now().After(expiry) {
+			return nil, false, nil
+		}
+		return payload[8:], true, nil
+	}
+	return nil, false, nil
+}
+
+// Commit keeps nothing, the data reaches the client by EncodeCookie
+func (s *CookieStore) Commit(token string, b []byte, expiry time.Time) error {
+	return nil
+}
+
+// Delete keeps nothing to delete
+func (s *CookieStore) Delete(token string) error {
+	return nil
+}
+
+// EncodeCookie returns the cookie value carrying the session data b until expiry
+func (s *CookieStore) EncodeCookie(b []byte, expiry time.Time) (string, error) {
+	aead := s.aeads[0]
+	payload := make([]byte, 8+len(b))
+	binary.BigEndian.PutUint64(payload, uint64(expiry.Unix()))
+	copy(payload[8:], b)
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(payload)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	value := base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, payload, nil))
+	if len(value) > maxCookieSize {
+		return "", ErrCookieTooLarge
+	}
+	return value, nil
+}
@@ -0,0 +1,96 @@
+package sessionstore
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, minKeySize)
+}
+
+func TestCookieStore(t *testing.T) {
+	s, err := NewCookieStore([][]byte{testKey(1)})
+	if err != nil {
+		t.Fatalf("NewCookieStore() error = %v", err)
+	}
+	data := []byte("csrfToken totp secret")
+	value, err := s.EncodeCookie(data, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("EncodeCookie() error = %v", err)
+	}
+	if strings.Contains(value, base64.RawURLEncoding.EncodeToString(data)) {
+		t.Error("the cookie carries the session data in clear text")
+	}
+	raw, _ := base64.RawURLEncoding.DecodeString(value)
+	if bytes.Contains(raw, data) {
+		t.Error("the cookie carries the session data in clear text")
+	}
+
+	b, found, err := s.Find(value)
+	if err != nil || !found || !bytes.Equal(b, data) {
+		t.Fatalf("Find() = %q, %v, %v, want %q", b, found, err, data)
+	}
+	if other, _ := s.EncodeCookie(data, time.Now().Add(time.Hour)); other == value {
+		t.Error("two cookies of the same data are equal, the nonce is not random")
+	}
+}
+
+func TestCookieStoreRejects(t *testing.T) {
+	s, _ := NewCookieStore([][]byte{testKey(1)})
+	valid, _ := s.EncodeCookie([]byte("data"), time.Now().Add(time.Hour))
+	expired, _ := s.EncodeCookie([]byte("data"), time.Now().Add(-time.Second))
+
+	raw, _ := base64.RawURLEncoding.DecodeString(valid)
+	raw[len(raw)-1] ^= 1
+	tampered := base64.RawURLEncoding.EncodeToString(raw)
+
+	other, _ := NewCookieStore([][]byte{testKey(2)})
+	wrongKey, _ := other.EncodeCookie([]byte("data"), time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"tampered", tampered},
+		{"expired", expired},
+		{"wrong key", wrongKey},
+		{"not base64", "!!!"},
+		{"too short", "AAAA"},
+		{"empty", ""},
+	}
+	for _, tt := range tests {
+		if b, found, err := s.Find(tt.value); found || err != nil {
+			t.Errorf("%s: Find() = %q, %v, %v, want not found", tt.name, b, found, err)
+		}
+	}
+}
+
+func TestCookieStoreKeyRotation(t *testing.T) {
+	old, _ := NewCookieStore([][]byte{testKey(1)})
+	value, _ := old.EncodeCookie([]byte("data"), time.Now().Add(time.Hour))
+
+	rotated, err := NewCookieStore([][]byte{testKey(2), testKey(1)})
+	if err != nil {
+		t.Fatalf("NewCookieStore() error = %v", err)
+	}
+	if _, found, _ := rotated.Find(value); !found {
+		t.Error("the cookie of the previous key is not accepted after the rotation")
+	}
+	newValue, _ := rotated.EncodeCookie([]byte("data"), time.Now().Add(time.Hour))
+	if _, found, _ := old.Find(newValue); found {
+		t.Error("the new cookies are encrypted with the previous key")
+	}
+}
+
+func TestNewCookieStoreKeys(t *testing.T) {
+	if _, err := NewCookieStore(nil); err == nil {
+		t.Error("NewCookieStore() without keys: no error")
+	}
+	if _, err := NewCookieStore([][]byte{[]byte("short")}); err == nil {
+		t.Error("NewCookieStore() with a short key: no error")
+	}
+}
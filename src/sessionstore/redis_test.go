@@ -0,0 +1,95 @@
+package sessionstore
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func newTestRedisStore(t *testing.T) *RedisStore {
+	standIn, err := StartStandIn("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("StartStandIn() error = %v", err)
+	}
+	s := NewRedisStore(standIn.Addr(), "secret", 1)
+	t.Cleanup(func() {
+		_ = s.Close()
+		_ = standIn.Close()
+	})
+	return s
+}
+
+func TestRedisStore(t *testing.T) {
+	s := newTestRedisStore(t)
+
+	if _, found, err := s.Find("missing"); found || err != nil {
+		t.Fatalf("Find(missing) = %v, %v, want not found", found, err)
+	}
+
+	data := []byte("session\r\ndata with the protocol line break")
+	if err := s.Commit("token", data, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	b, found, err := s.Find("token")
+	if err != nil || !found || !bytes.Equal(b, data) {
+		t.Fatalf("Find(token) = %q, %v, %v, want %q", b, found, err, data)
+	}
+
+	if err := s.Commit("token", []byte("changed"), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if b, _, _ := s.Find("token"); string(b) != "changed" {
+		t.Errorf("Find(token) after the second Commit = %q, want %q", b, "changed")
+	}
+
+	if err := s.Delete("token"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, found, err := s.Find("token"); found || err != nil {
+		t.Errorf("Find(token) after Delete = %v, %v, want not found", found, err)
+	}
+	if err := s.Delete("token"); err != nil {
+		t.Errorf("Delete() of a missing key error = %v", err)
+	}
+}
+
+func TestRedisStoreExpiry(t *testing.T) {
+	s := newTestRedisStore(t)
+
+	if err := s.Commit("short", []byte("data"), time.Now().Add(50*time.Millisecond)); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if _, found, _ := s.Find("short"); !found {
+		t.Fatal("Find(short) before the expiry: not found")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, found, err := s.Find("short"); found || err != nil {
+		t.Errorf("Find(short) after the expiry = %v, %v, want not found", found, err)
+	}
+
+	// a session committed after its expiry is deleted instead of stored
+	if err := s.Commit("past", []byte("data"), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if err := s.Commit("past", []byte("data"), time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("Commit() with a past expiry error = %v", err)
+	}
+	if _, found, err := s.Find("past"); found || err != nil {
+		t.Errorf("Find(past) = %v, %v, want not found", found, err)
+	}
+}
+
+func TestRedisStoreUnavailable(t *testing.T) {
+	standIn, err := StartStandIn("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("StartStandIn() error = %v", err)
+	}
+	addr := standIn.Addr()
+	_ = standIn.Close()
+
+	s := NewRedisStore(addr, "", 0)
+	defer s.Close()
+	if _, _, err := s.Find("token"); err == nil {
+		t.Error("Find() without a server: no error")
+	}
+}
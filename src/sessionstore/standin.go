@@ -0,0 +1,187 @@
+package sessionstore
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const standInSweep = 10000
+
+// StandIn is a minimal in-process server of the redis protocol: PING, AUTH, SELECT, GET, SET with PX and DEL
+// on one in-memory keyspace. It lets the redis store run where no redis server is available,
+// e.g. in the session store benchmark or on a developer machine.
+type StandIn struct {
+	listener net.Listener
+	mu       sync.Mutex
+	data     map[string]standInEntry
+	sets     int
+}
+
+type standInEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// StartStandIn listens on addr, e.g. "127.0.0.1:0" for a free port
+func StartStandIn(addr string) (*StandIn, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &StandIn{listener: listener, data: make(map[string]standInEntry)}
+	go s.serve()
+	return s, nil
+}
+
+// Addr is the address the stand-in listens on
+func (s *StandIn) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops listening, the open connections end when their clients close them
+func (s *StandIn) Close() error {
+	return s.listener.Close()
+}
+
+func (s *StandIn) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *StandIn) serveConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			if err != io.EOF {
+				writeStandInError(w, err.Error())
+				_ = w.Flush()
+			}
+			return
+		}
+		if args, ok := commandArgs(reply); ok {
+			s.exec(w, args)
+		} else {
+			writeStandInError(w, "ERR expected a command")
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// commandArgs converts the command, a non empty array of bulk strings
+func commandArgs(reply interface{}) ([][]byte, bool) {
+	items, ok := reply.([]interface{})
+	if !ok || len(items) == 0 {
+		return nil, false
+	}
+	args := make([][]byte, len(items))
+	for i, item := range items {
+		if args[i], ok = item.([]byte); !ok {
+			return nil, false
+		}
+	}
+	return args, true
+}
+
+func (s *StandIn) exec(w *bufio.Writer, args [][]byte) {
+	switch strings.ToUpper(string(args[0])) {
+	case "PING":
+		w.WriteString("+PONG\r\n")
+	case "AUTH", "SELECT":
+		// one keyspace for everybody, the stand-in is for local use only
+		w.WriteString("+OK\r\n")
+	case "GET":
+		if len(args) != 2 {
+			writeStandInError(w, "ERR wrong number of arguments for 'get' command")
+			return
+		}
+		value, ok := s.get(string(args[1]))
+		if !ok {
+			w.WriteString("$-1\r\n")
+			return
+		}
+		fmt.Fprintf(w, "$%d\r\n", len(value))
+		w.Write(value)
+		w.WriteString("\r\n")
+	case "SET":
+		if len(args) != 3 && len(args) != 5 {
+			writeStandInError(w, "ERR syntax error")
+			return
+		}
+		entry := standInEntry{value: args[2]}
+		if len(args) == 5 {
+			ms, err := strconv.ParseInt(string(args[4]), 10, 64)
+			if !strings.EqualFold(string(args[3]), "PX") || err != nil || ms <= 0 {
+				writeStandInError(w, "ERR syntax error")
+				return
+			}
+			entry.expires = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		s.set(string(args[1]), entry)
+		w.WriteString("+OK\r\n")
+	case "DEL":
+		deleted := 0
+		s.mu.Lock()
+		for _, key := range args[1:] {
+			if _, ok := s.data[string(key)]; ok {
+				delete(s.data, string(key))
+				deleted++
+			}
+		}
+		s.mu.Unlock()
+		fmt.Fprintf(w, ":%d\r\n", deleted)
+	default:
+		writeStandInError(w, fmt.Sprintf("ERR unknown command '%s'", args[0]))
+	}
+}
+
+// get returns the unexpired value of the key, the expired keys are deleted on access
+func (s *StandIn) get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.data[key]
+	if !ok {
+		return nil, false
+	}
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		delete(s.data, key)
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// set stores the entry, every standInSweep sets the expired keys nobody reads any more are deleted
+func (s *StandIn) set(key string, entry standInEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = entry
+	s.sets++
+	if s.sets%standInSweep != 0 {
+		return
+	}
+	now := time.Now()
+	for k, e := range s.data {
+		if !e.expires.IsZero() && now.After(e.expires) {
+			delete(s.data, k)
+		}
+	}
+}
+
+func writeStandInError(w *bufio.Writer, msg string) {
+	w.WriteString("-" + strings.NewReplacer("\r", " ", "\n", " ").Replace(msg) + "\r\n")
+}
@@ -0,0 +1,64 @@
+package sessionstore
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/alexedwards/scs/mysqlstore"
+	"github.com/alexedwards/scs/v2"
+	"github.com/alexedwards/scs/v2/memstore"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options are what the stores need besides the spec: DB for mysql, CookieKeys for cookie
+type Options struct {
+	DB *sql.DB
+	// CookieKeys are comma separated base64 keys of at least 32 bytes, the first one encrypts the new cookies
+	CookieKeys string
+	// CleanupInterval is how often the mysql and memory stores delete the expired sessions
+	CleanupInterval time.Duration
+}
+
+// New creates the session store by its spec: "mysql", "memory", "redis://[:password@]host:port[/db]" or "cookie".
+// stop ends the background cleanup of the store and closes its connections.
+func New(spec string, opts Options) (store scs.Store, stop func(), err error) {
+	switch {
+	case spec == "mysql":
+		if opts.DB == nil {
+			return nil, nil, fmt.Errorf("session store: mysql requires the database")
+		}
+		s := mysqlstore.NewWithCleanupInterval(opts.DB, opts.CleanupInterval)
+		return s, s.StopCleanup, nil
+	case spec == "memory":
+		s := memstore.NewWithCleanupInterval(opts.CleanupInterval)
+		return s, s.StopCleanup, nil
+	case strings.HasPrefix(spec, "redis://"):
+		u, err := url.Parse(spec)
+		if err != nil {
+			return nil, nil, fmt.Errorf("session store: %w", err)
+		}
+		password, _ := u.User.Password()
+		db := 0
+		if path := strings.TrimPrefix(u.Path, "/"); len(path) > 0 {
+			if db, err = strconv.Atoi(path); err != nil {
+				return nil, nil, fmt.Errorf("session store: invalid redis database %q", path)
+			}
+		}
+		s := NewRedisStore(u.Host, password, db)
+		return s, func() { _ = s.Close() }, nil
+	case spec == "cookie":
+		keys, err := ParseKeys(opts.CookieKeys)
+		if err != nil {
+			return nil, nil, err
+		}
+		s, err := NewCookieStore(keys)
+		if err != nil {
+			return nil, nil, err
+		}
+		return s, func() {}, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown session store %q", spec)
+	}
+}
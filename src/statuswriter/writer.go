@@ -0,0 +1,47 @@
+package statuswriter
+
+import "net/http"
+
+// Writer records the status and the size of the response for the access log, the metrics and the traces
+type Writer struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+// Wrap returns w if it already records the response, the middlewares share one Writer per request
+func Wrap(w http.ResponseWriter) *Writer {
+	if sw, ok := w.(*Writer); ok {
+		return sw
+	}
+	return &Writer{ResponseWriter: w}
+}
+
+func (w *Writer) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *Writer) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// Status is the response status, 200 if the handler wrote nothing
+func (w *Writer) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// Bytes is the size of the response body written so far
+func (w *Writer) Bytes() int {
+	return w.bytes
+}
@@ -0,0 +1,69 @@
+package throttle
+
+import (
+	"time"
+)
+
+// LoginGuard tracks failed logins per login and per client ip: guessing the password of one account is slowed down
+// by the login counter, trying one password against many accounts by the ip counter
+type LoginGuard struct {
+	logins *Tracker
+	ips    *Tracker
+}
+
+// Failure is the outcome of a failed attempt
+type Failure struct {
+	// Wait is the delay before the next attempt of the login or the ip
+	Wait        time.Duration
+	LoginLocked bool
+	IPLocked    bool
+}
+
+func NewLoginGuard(login Policy, ip Policy) *LoginGuard {
+	return &LoginGuard{logins: NewTracker(login), ips: NewTracker(ip)}
+}
+
+// Reserve starts an attempt of the login from the ip and returns 0, or returns how long the attempt has to wait.
+// The attempt ends with Fail, Succeed or Release.
+func (g *LoginGuard) Reserve(login string, ip string) time.Duration {
+	if wait := g.logins.Reserve(login); wait > 0 {
+		return wait
+	}
+	if wait := g.ips.Reserve(ip); wait > 0 {
+		g.logins.Release(login)
+		return wait
+	}
+	return 0
+}
+
+func (g *LoginGuard) Fail(login string, ip string) Failure {
+	loginWait, loginLocked := g.logins.Fail(login)
+	ipWait, ipLocked := g.ips.Fail(ip)
+	return Failure{Wait: maxDuration(loginWait, ipWait), LoginLocked: loginLocked, IPLocked: ipLocked}
+}
+
+// Succeed resets the login counter. The ip counter is kept: an attacker must not reset it
+// by signing in to an own account between the attempts.
+func (g *LoginGuard) Succeed(login string, ip string) {
+	g.logins.Reset(login)
+	g.ips.Release(ip)
+}
+
+// Release ends the attempt which could not be checked, it counts neither as a failure nor as a success
+func (g *LoginGuard) Release(login string, ip string) {
+	g.logins.Release(login)
+	g.ips.Release(ip)
+}
+
+// RunCleanup drops the forgotten counters every interval until stop is closed
+func (g *LoginGuard) RunCleanup(interval time.Duration, stop <-chan struct{}) {
+	go g.ips.RunCleanup(interval, stop)
+	g.logins.RunCleanup(interval, stop)
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
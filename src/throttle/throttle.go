@@ -0,0 +1,169 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// Policy of a Tracker: after a failure the next attempt is delayed by BaseDelay doubled on every further failure
+// up to MaxDelay, after MaxFailures failures the key is locked for Lockout. Failures are forgotten Window after
+// the last one.
+type Policy struct {
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	MaxFailures int
+	Lockout     time.Duration
+	Window      time.Duration
+}
+
+// inFlightWait is returned to an attempt refused because others of the key are still being checked:
+// their outcome decides the delay, it is not known yet
+const inFlightWait = time.Second
+
+// Tracker counts failed attempts per key in memory, the counters are local to the instance.
+// An attempt is reserved before it is checked and counts against the limits until its outcome is recorded,
+// so concurrent attempts can not all pass the check made before any of them failed.
+type Tracker struct {
+	mu      sync.Mutex
+	policy  Policy
+	entries map[string]*failures
+	now     func() time.Time
+}
+
+type failures struct {
+	count int
+	last  time.Time
+	// until is the earliest time of the next allowed attempt
+	until time.Time
+	// inFlight is the number of the reserved attempts without an outcome
+	inFlight int
+}
+
+func NewTracker(policy Policy) *Tracker {
+	return &Tracker{policy: policy, entries: make(map[string]*failures), now: time.Now}
+}
+
+// Reserve starts an attempt of the key and returns 0, or returns how long the key has to wait. With a backoff
+// only one attempt of the key is checked at a time; without one the attempts in flight and the failures
+// together may not exceed MaxFailures. A reserved attempt ends with Fail, Reset or Release.
+func (t *Tracker) Reserve(key string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	f, ok := t.entries[key]
+	if !ok || t.expired(f, now) {
+		f = new(failures)
+		t.entries[key] = f
+	}
+	if f.until.After(now) {
+		return f.until.Sub(now)
+	}
+	if f.inFlight > 0 && (t.policy.BaseDelay > 0 ||
+		t.policy.MaxFailures > 0 && f.count+f.inFlight >= t.policy.MaxFailures) {
+		return inFlightWait
+	}
+	f.inFlight++
+	return 0
+}
+
+// Release ends the reserved attempt without an outcome, e.g. when the check itself failed
+func (t *Tracker) Release(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if f, ok := t.entries[key]; ok {
+		t.release(key, f)
+	}
+}
+
+func (t *Tracker) release(key string, f *failures) {
+	if f.inFlight > 0 {
+		f.inFlight--
+	}
+	if f.inFlight == 0 && f.count == 0 {
+		delete(t.entries, key)
+	}
+}
+
+// Fail ends the reserved attempt as failed and returns the delay before the next one and whether the key got locked
+func (t *Tracker) Fail(key string) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	f, ok := t.entries[key]
+	if !ok || t.expired(f, now) {
+		f = new(failures)
+		t.entries[key] = f
+	}
+	if f.inFlight > 0 {
+		f.inFlight--
+	}
+	f.count++
+	f.last = now
+
+	if t.policy.MaxFailures > 0 && f.count >= t.policy.MaxFailures {
+		f.until = now.Add(t.policy.Lockout)
+		return t.policy.Lockout, f.count == t.policy.MaxFailures
+	}
+	delay := t.policy.BaseDelay
+	for i := 1; i < f.count && delay < t.policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > t.policy.MaxDelay {
+		delay = t.policy.MaxDelay
+	}
+	f.until = now.Add(delay)
+	return delay, false
+}
+
+// Reset ends the reserved attempt as successful and forgets the failures of the key
+func (t *Tracker) Reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if f, ok := t.entries[key]; ok {
+		f.count = 0
+		f.until = time.Time{}
+		t.release(key, f)
+	}
+}
+
+func (t *Tracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.entries)
+}
+
+// expired failures are forgotten, but never before the lockout ends or while attempts are in flight
+func (t *Tracker) expired(f *failures, now time.Time) bool {
+	return f.inFlight == 0 && now.Sub(f.last) > t.policy.Window && !f.until.After(now)
+}
+
+// Cleanup drops the forgotten keys, so keys which never come back do not hold memory
+func (t *Tracker) Cleanup() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	for key, f := range t.entries {
+		if t.expired(f, now) {
+			delete(t.entries, key)
+		}
+	}
+}
+
+// RunCleanup calls Cleanup every interval until stop is closed
+func (t *Tracker) RunCleanup(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			t.Cleanup()
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time { return c.now }
+
+func newTestTracker(policy Policy) (*Tracker, *clock) {
+	c := &clock{now: time.Unix(0, 0)}
+	t := NewTracker(policy)
+	t.now = c.Now
+	return t, c
+}
+
+func TestTrackerFailDelays(t *testing.T) {
+	policy := Policy{BaseDelay: time.Second, MaxDelay: 5 * time.Second, MaxFailures: 5, Lockout: time.Minute, Window: time.Hour}
+	tests := []struct {
+		failures int
+		delay    time.Duration
+		locked   bool
+	}{
+		{1, time.Second, false},
+		{2, 2 * time.Second, false},
+		{3, 4 * time.Second, false},
+		{4, 5 * time.Second, false},
+		{5, time.Minute, true},
+		{6, time.Minute, false},
+	}
+	for _, tt := range tests {
+		tracker, _ := newTestTracker(policy)
+		var delay time.Duration
+		var locked bool
+		for i := 0; i < tt.failures; i++ {
+			delay, locked = tracker.Fail("key")
+		}
+		if delay != tt.delay || locked != tt.locked {
+			t.Errorf("%d failures: Fail() = %s, %v, want %s, %v", tt.failures, delay, locked, tt.delay, tt.locked)
+		}
+		if wait := tracker.Reserve("key"); wait != tt.delay {
+			t.Errorf("%d failures: Reserve() = %s, want %s", tt.failures, wait, tt.delay)
+		}
+	}
+}
+
+func TestTrackerReserve(t *testing.T) {
+	backoff := Policy{BaseDelay: time.Second, MaxDelay: time.Minute, MaxFailures: 3, Lockout: time.Minute, Window: time.Hour}
+	lockoutOnly := Policy{MaxFailures: 3, Lockout: time.Minute, Window: time.Hour}
+	tests := []struct {
+		name   string
+		policy Policy
+		// steps are the calls made in order: r reserves, f fails, s resets, x releases, + advances the clock by 1s
+		steps string
+		// wait is the result of Reserve after the steps
+		wait time.Duration
+	}{
+		{"first attempt", backoff, "", 0},
+		{"attempt in flight with backoff", backoff, "r", inFlightWait},
+		{"attempt released", backoff, "rx", 0},
+		{"attempt succeeded", backoff, "rs", 0},
+		{"attempt failed", backoff, "rf", time.Second},
+		{"backoff passed", backoff, "rf+", 0},
+		{"reset after failures", backoff, "rf+rf++rs", 0},
+		{"attempts in flight within the limit", lockoutOnly, "rr", 0},
+		{"attempts in flight up to the limit", lockoutOnly, "rrr", inFlightWait},
+		{"failures and attempts in flight up to the limit", lockoutOnly, "rfrfr", inFlightWait},
+		{"locked", lockoutOnly, "rfrfrf", time.Minute},
+		{"released attempt frees the slot", lockoutOnly, "rrrx", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker, c := newTestTracker(tt.policy)
+			for _, step := range tt.steps {
+				switch step {
+				case 'r':
+					if wait := tracker.Reserve("key"); wait != 0 {
+						t.Fatalf("step Reserve() = %s, want 0", wait)
+					}
+				case 'f':
+					tracker.Fail("key")
+				case 's':
+					tracker.Reset("key")
+				case 'x':
+					tracker.Release("key")
+				case '+':
+					c.now = c.now.Add(time.Second)
+				}
+			}
+			if wait := tracker.Reserve("key"); wait != tt.wait {
+				t.Errorf("Reserve() = %s, want %s", wait, tt.wait)
+			}
+		})
+	}
+}
+
+func TestTrackerForgets(t *testing.T) {
+	tracker, c := newTestTracker(Policy{BaseDelay: time.Second, MaxDelay: time.Minute, Window: time.Minute})
+
+	tracker.Reserve("key")
+	tracker.Fail("key")
+	tracker.Reserve("other")
+	c.now = c.now.Add(2 * time.Minute)
+	tracker.Cleanup()
+	if n := tracker.Len(); n != 1 {
+		t.Fatalf("Len() after Cleanup = %d, want 1: the attempt in flight is kept", n)
+	}
+	tracker.Release("other")
+	if n := tracker.Len(); n != 0 {
+		t.Errorf("Len() after Release = %d, want 0", n)
+	}
+}
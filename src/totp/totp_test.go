@@ -0,0 +1,91 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key of the RFC 6238 test vectors, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// TestCode checks the RFC 6238 appendix B SHA1 vectors, the codes are the last 6 of the 8 digits there
+func TestCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		step int64
+		code string
+	}{
+		{59, 0x1, "287082"},
+		{1111111109, 0x23523EC, "081804"},
+		{1111111111, 0x23523ED, "050471"},
+		{1234567890, 0x273EF07, "005924"},
+		{2000000000, 0x3F940AA, "279037"},
+		{20000000000, 0x27BC86AA, "353130"},
+	}
+	for _, tt := range tests {
+		step := Step(time.Unix(tt.unix, 0))
+		if step != tt.step {
+			t.Errorf("Step(%d) = %#x, want %#x", tt.unix, step, tt.step)
+		}
+		code, err := Code(rfcSecret, step)
+		if err != nil || code != tt.code {
+			t.Errorf("Code(%d) = %q, %v, want %q", tt.unix, code, err, tt.code)
+		}
+		// the apps may show the secret in lower case
+		if code, _ := Code(strings.ToLower(rfcSecret), step); code != tt.code {
+			t.Errorf("Code(%d) with the lower case secret = %q, want %q", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestCodeInvalidSecret(t *testing.T) {
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code() with an invalid secret: no error")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	// 1111111111 is step 0x23523ED, 1111111109 is the step before it
+	now := time.Unix(1111111111, 0)
+	tests := []struct {
+		name string
+		code string
+		t    time.Time
+		skew int
+		step int64
+		ok   bool
+	}{
+		{"current step", "050471", now, 1, 0x23523ED, true},
+		{"previous step within the skew", "081804", now, 1, 0x23523EC, true},
+		{"next step within the skew", "050471", now.Add(-Period), 1, 0x23523ED, true},
+		{"previous step without skew", "081804", now, 0, 0, false},
+		{"two steps back with the skew of one", "050471", now.Add(2 * Period), 1, 0, false},
+		{"two steps back with the skew of two", "050471", now.Add(2 * Period), 2, 0x23523ED, true},
+		{"wrong code", "123456", now, 1, 0, false},
+		{"short code", "50471", now, 1, 0, false},
+		{"long code", "0504710", now, 1, 0, false},
+		{"empty code", "", now, 1, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, tt.code, tt.t, tt.skew)
+			if step != tt.step || ok != tt.ok {
+				t.Errorf("Validate(%q) = %#x, %v, want %#x, %v", tt.code, step, ok, tt.step, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatalf("NewSecret() error = %v", err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("NewSecret() = %q, want 32 base32 chars of 20 bytes", secret)
+	}
+	if _, err := Code(secret, 1); err != nil {
+		t.Errorf("Code() with a new secret: %v", err)
+	}
+}
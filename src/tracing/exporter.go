@@ -0,0 +1,117 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type jsonSpan struct {
+	TraceID    string                 `json:"trace_id"`
+	SpanID     string                 `json:"span_id"`
+	ParentID   string                 `json:"parent_id,omitempty"`
+	Name       string                 `json:"name"`
+	Start      time.Time              `json:"start"`
+	DurationMs float64                `json:"duration_ms"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+// writerExporter writes spans as JSON lines, the output is flushed every second and on shutdown
+type writerExporter struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	closer io.Closer
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewExporter creates the exporter by its spec: "stdout" or "file:<path>"
+func NewExporter(spec string) (Exporter, error) {
+	switch {
+	case spec == "stdout":
+		return NewWriterExporter(os.Stdout), nil
+	case strings.HasPrefix(spec, "file:"):
+		return NewFileExporter(strings.TrimPrefix(spec, "file:"))
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", spec)
+	}
+}
+
+// NewWriterExporter exports spans to w (e.g. os.Stdout)
+func NewWriterExporter(w io.Writer) Exporter {
+	e := &writerExporter{w: bufio.NewWriter(w), done: make(chan struct{})}
+	go e.flushLoop()
+	return e
+}
+
+// NewFileExporter appends spans to the file, it works offline and the file may be loaded to any trace viewer later
+func NewFileExporter(path string) (Exporter, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	e := NewWriterExporter(f).(*writerExporter)
+	e.closer = f
+	return e, nil
+}
+
+func (e *writerExporter) ExportSpan(span *SpanData) {
+	js := jsonSpan{
+		TraceID:    span.Context.TraceID.String(),
+		SpanID:     span.Context.SpanID.String(),
+		Name:       span.Name,
+		Start:      span.Start,
+		DurationMs: float64(span.End.Sub(span.Start).Microseconds()) / 1000,
+		Attributes: span.Attributes,
+		Error:      span.Error,
+	}
+	if span.ParentID != (SpanID{}) {
+		js.ParentID = span.ParentID.String()
+	}
+	b, err := json.Marshal(js)
+	if err != nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, _ = e.w.Write(append(b, '\n'))
+}
+
+func (e *writerExporter) flushLoop() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-ticker.C:
+			e.mu.Lock()
+			_ = e.w.Flush()
+			e.mu.Unlock()
+		}
+	}
+}
+
+func (e *writerExporter) Shutdown(ctx context.Context) error {
+	var err error
+	e.once.Do(func() {
+		close(e.done)
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		err = e.w.Flush()
+		if e.closer != nil {
+			if closeErr := e.closer.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	})
+	return err
+}
@@ -0,0 +1,40 @@
+package tracing
+
+import (
+	"github.com/gorilla/mux"
+	"net/http"
+	"otus-hiload/src/logger"
+	"otus-hiload/src/statuswriter"
+)
+
+// HTTPHandler starts the root span of the request, continuing the trace of the incoming traceparent header.
+// The trace id is added to the request logger.
+func HTTPHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if parent, ok := ParseTraceparent(r.Header.Get(TraceparentHeader)); ok {
+			ctx = ContextWithRemoteParent(ctx, parent)
+		}
+
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if tpl, err := current.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+
+		ctx, span := Start(ctx, "HTTP "+r.Method+" "+route)
+		defer span.End()
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("http.target", r.URL.RequestURI())
+
+		if sc, ok := SpanContextFromContext(ctx); ok {
+			ctx = logger.WithContext(ctx, logger.FromContext(ctx).With("trace_id", sc.TraceID.String()))
+		}
+
+		sw := statuswriter.Wrap(w)
+		h.ServeHTTP(sw, r.WithContext(ctx))
+		span.SetAttribute("http.status_code", sw.Status())
+	})
+}
@@ -0,0 +1,173 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type ctxKey struct{}
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanContext identifies a span across process boundaries
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// SpanData is the finished span passed to the exporter
+type SpanData struct {
+	Name       string
+	Context    SpanContext
+	ParentID   SpanID
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]interface{}
+	Error      string
+}
+
+// Span measures an operation. All methods are no-op on a nil span, which is returned when tracing is disabled
+// or the trace is not sampled, so callers never check it.
+type Span struct {
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// Exporter receives finished spans
+type Exporter interface {
+	ExportSpan(span *SpanData)
+	// Shutdown flushes buffered spans and releases the exporter
+	Shutdown(ctx context.Context) error
+}
+
+var (
+	exporter Exporter
+	// sampleRatio holds math.Float64bits of the ratio, it is changed on config reload
+	sampleRatio = math.Float64bits(1)
+)
+
+// SetExporter enables tracing, ratio is the share of new traces sampled (0..1).
+// Traces continued from an incoming traceparent keep the caller's sampling decision.
+func SetExporter(e Exporter, ratio float64) {
+	exporter = e
+	SetSampleRatio(ratio)
+}
+
+// SetSampleRatio changes the share of sampled traces, it is safe to call while serving
+func SetSampleRatio(ratio float64) {
+	atomic.StoreUint64(&sampleRatio, math.Float64bits(ratio))
+}
+
+// Shutdown flushes the exporter
+func Shutdown(ctx context.Context) error {
+	if exporter == nil {
+		return nil
+	}
+	return exporter.Shutdown(ctx)
+}
+
+// Start starts a span as a child of the span in ctx (or of the remote parent set with ContextWithRemoteParent)
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	if exporter == nil {
+		return ctx, nil
+	}
+
+	span := &Span{data: SpanData{Name: name, Start: time.Now()}}
+	parent, ok := ctx.Value(ctxKey{}).(SpanContext)
+	if ok {
+		if !parent.Sampled {
+			return ctx, nil
+		}
+		span.data.Context.TraceID = parent.TraceID
+		span.data.ParentID = parent.SpanID
+	} else {
+		if !sample() {
+			return context.WithValue(ctx, ctxKey{}, SpanContext{}), nil
+		}
+		_, _ = rand.Read(span.data.Context.TraceID[:])
+	}
+	_, _ = rand.Read(span.data.Context.SpanID[:])
+	span.data.Context.Sampled = true
+
+	return context.WithValue(ctx, ctxKey{}, span.data.Context), span
+}
+
+func sample() bool {
+	ratio := math.Float64frombits(atomic.LoadUint64(&sampleRatio))
+	if ratio >= 1 {
+		return true
+	}
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	var n uint64
+	for _, v := range b {
+		n = n<<8 | uint64(v)
+	}
+	return float64(n) < ratio*math.MaxUint64
+}
+
+// ContextWithRemoteParent makes spans started from ctx children of the remote span
+func ContextWithRemoteParent(ctx context.Context, parent SpanContext) context.Context {
+	return context.WithValue(ctx, ctxKey{}, parent)
+}
+
+// SpanContextFromContext returns the context of the current span
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(ctxKey{}).(SpanContext)
+	return sc, ok && sc.Sampled
+}
+
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]interface{})
+	}
+	s.data.Attributes[key] = value
+}
+
+// SetError marks the span failed, nil err is ignored
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Error = err.Error()
+}
+
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	exporter.ExportSpan(&data)
+}
@@ -0,0 +1,35 @@
+package validation
+
+import (
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+// CheckFile validates the uploaded file size and its type sniffed from the content, the declared
+// Content-Type and the file name are not trusted
+func (v *Validator) CheckFile(field string, file multipart.File, header *multipart.FileHeader, maxSize int64, types ...string) {
+	if header.Size > maxSize {
+		v.Add(field, Violation{Key: "validation.file_size", Args: []interface{}{int(maxSize >> 20)}, Plural: true})
+		return
+	}
+
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		v.Add(field, Violation{Key: "validation.file_read"})
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		v.Add(field, Violation{Key: "validation.file_read"})
+		return
+	}
+
+	contentType := http.DetectContentType(buf[:n])
+	for _, t := range types {
+		if contentType == t {
+			return
+		}
+	}
+	v.Add(field, Violation{Key: "validation.file_type"})
+}
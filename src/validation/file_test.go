@@ -0,0 +1,68 @@
+package validation
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"testing"
+)
+
+// memFile is an uploaded file kept in memory
+type memFile struct {
+	*bytes.Reader
+}
+
+func (memFile) Close() error {
+	return nil
+}
+
+func pngImage(t *testing.T) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	img.Set(0, 0, color.White)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCheckFile(t *testing.T) {
+	const maxSize = 1 << 20
+	types := []string{"image/jpeg", "image/png", "image/gif"}
+	pngData := pngImage(t)
+	html := []byte("<html><script>alert(1)</script></html>")
+
+	tests := []struct {
+		name string
+		data []byte
+		size int64
+		want string
+	}{
+		{"avatar.png", pngData, int64(len(pngData)), ""},
+		// the extension does not matter, the content is sniffed
+		{"avatar.jpg", pngData, int64(len(pngData)), ""},
+		{"avatar", pngData, int64(len(pngData)), ""},
+		{"avatar.png", html, int64(len(html)), "validation.file_type"},
+		{"avatar.gif", []byte("GIF87"), 5, "validation.file_type"},
+		{"avatar.png", nil, 0, "validation.file_type"},
+		{"avatar.png", pngData, maxSize + 1, "validation.file_size"},
+	}
+	for _, tt := range tests {
+		var v Validator
+		file := memFile{bytes.NewReader(tt.data)}
+		v.CheckFile("avatar", file, &multipart.FileHeader{Filename: tt.name, Size: tt.size}, maxSize, types...)
+		got := ""
+		if errs, ok := v.Err().(Errors); ok {
+			got = errs["avatar"].Key
+		}
+		if got != tt.want {
+			t.Errorf("CheckFile(%q, %d bytes) = %q, want %q", tt.name, len(tt.data), got, tt.want)
+		}
+		// the file is rewound for the storage
+		if len(tt.want) == 0 && file.Len() != len(tt.data) {
+			t.Errorf("CheckFile(%q) left %d of %d bytes unread", tt.name, file.Len(), len(tt.data))
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package validation
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	loginRegexp = regexp.MustCompile(`^[a-z0-9._-]+$`)
+	// emailRegexp only catches typos, the address is confirmed by delivering to it
+	emailRegexp = regexp.MustCompile(`^[^\s@<>,;"]+@[^\s@<>,;"]+\.[^\s@<>,;"]+$`)
+)
+
+// bcryptMaxPasswordBytes is the part of the password bcrypt uses, the rest is ignored silently
+const bcryptMaxPasswordBytes = 72
+
+func violation(key string, args ...interface{}) *Violation {
+	return &Violation{Key: key, Args: args}
+}
+
+func Required() Rule {
+	return func(value string) *Violation {
+		if len(strings.TrimSpace(value)) == 0 {
+			return violation("validation.required")
+		}
+		return nil
+	}
+}
+
+// MinRunes counts characters, not bytes: a Cyrillic letter is two bytes in UTF-8
+func MinRunes(n int) Rule {
+	return func(value string) *Violation {
+		if utf8.RuneCountInString(value) < n {
+			return &Violation{Key: "validation.min_runes", Args: []interface{}{n}, Plural: true}
+		}
+		return nil
+	}
+}
+
+func MaxRunes(n int) Rule {
+	return func(value string) *Violation {
+		if utf8.RuneCountInString(value) > n {
+			return &Violation{Key: "validation.max_runes", Args: []interface{}{n}, Plural: true}
+		}
+		return nil
+	}
+}
+
+// Login allows latin letters, digits, dots, dashes and underscores, the value must be normalized first
+func Login() Rule {
+	return func(value string) *Violation {
+		if !loginRegexp.MatchString(value) {
+			return violation("validation.login")
+		}
+		return nil
+	}
+}
+
+func Email() Rule {
+	return func(value string) *Violation {
+		if !emailRegexp.MatchString(value) {
+			return violation("validation.email")
+		}
+		return nil
+	}
+}
+
+// Name allows letters of any alphabet separated by single spaces, dashes or apostrophes
+func Name() Rule {
+	return func(value string) *Violation {
+		prevLetter := false
+		for _, r := range value {
+			switch {
+			case unicode.IsLetter(r):
+				prevLetter = true
+			case (r == ' ' || r == '-' || r == '\'') && prevLetter:
+				prevLetter = false
+			default:
+				return violation("validation.name")
+			}
+		}
+		if !prevLetter {
+			return violation("validation.name")
+		}
+		return nil
+	}
+}
+
+// Password requires at least min characters with a letter and a digit, and no more than bcrypt uses
+func Password(min int) Rule {
+	return func(value string) *Violation {
+		if utf8.RuneCountInString(value) < min {
+			return &Violation{Key: "validation.password_length", Args: []interface{}{min}, Plural: true}
+		}
+		if len(value) > bcryptMaxPasswordBytes {
+			return &Violation{Key: "validation.password_too_long", Args: []interface{}{bcryptMaxPasswordBytes}, Plural: true}
+		}
+		hasLetter, hasDigit := false, false
+		for _, r := range value {
+			hasLetter = hasLetter || unicode.IsLetter(r)
+			hasDigit = hasDigit || unicode.IsDigit(r)
+		}
+		if !hasLetter || !hasDigit {
+			return violation("validation.password_weak")
+		}
+		return nil
+	}
+}
+
+// Equal requires the value to match the other one, e.g. the password confirmation
+func Equal(other string, key string) Rule {
+	return func(value string) *Violation {
+		if value != other {
+			return violation(key)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,166 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+)
+
+// key returns the key of the violation or "" if the value is valid
+func key(v *Violation) string {
+	if v == nil {
+		return ""
+	}
+	return v.Key
+}
+
+func TestRunes(t *testing.T) {
+	tests := []struct {
+		rule  Rule
+		value string
+		want  string
+	}{
+		{MinRunes(3), "ab", "validation.min_runes"},
+		{MinRunes(3), "abc", ""},
+		// "Ян" is four bytes but two characters
+		{MinRunes(3), "Ян", "validation.min_runes"},
+		{MinRunes(2), "Ян", ""},
+		{MaxRunes(3), "abcd", "validation.max_runes"},
+		{MaxRunes(3), "abc", ""},
+		// six bytes, three characters
+		{MaxRunes(3), "Аня", ""},
+		{MaxRunes(3), "Анна", "validation.max_runes"},
+		{MaxRunes(2), "日本", ""},
+		{MaxRunes(1), "日本", "validation.max_runes"},
+	}
+	for _, tt := range tests {
+		if got := key(tt.rule(tt.value)); got != tt.want {
+			t.Errorf("rule(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRequired(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", "validation.required"},
+		{" \t\n", "validation.required"},
+		{"a", ""},
+		{" a ", ""},
+	}
+	for _, tt := range tests {
+		if got := key(Required()(tt.value)); got != tt.want {
+			t.Errorf("Required()(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestLogin(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"ivan", ""},
+		{"ivan.petrov_1-2", ""},
+		{"", "validation.login"},
+		// the value is normalized to lower case before the check
+		{"Ivan", "validation.login"},
+		{"ivan petrov", "validation.login"},
+		{"иван", "validation.login"},
+		{"ivan@example.com", "validation.login"},
+		{"ivan/../admin", "validation.login"},
+		{"ivan\n", "validation.login"},
+		{"<script>", "validation.login"},
+	}
+	for _, tt := range tests {
+		if got := key(Login()(tt.value)); got != tt.want {
+			t.Errorf("Login()(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestEmail(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"ivan@example.com", ""},
+		{"ivan+tag@mail.example.ru", ""},
+		{"", "validation.email"},
+		{"ivan", "validation.email"},
+		{"ivan@example", "validation.email"},
+		{"ivan@@example.com", "validation.email"},
+		{"ivan petrov@example.com", "validation.email"},
+		{"<ivan@example.com>", "validation.email"},
+		{"ivan@example.com, eve@example.com", "validation.email"},
+	}
+	for _, tt := range tests {
+		if got := key(Email()(tt.value)); got != tt.want {
+			t.Errorf("Email()(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestName(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"Ivan", ""},
+		{"Иван", ""},
+		{"Анна-Мария", ""},
+		{"O'Brien", ""},
+		{"Jean Paul", ""},
+		{"Søren", ""},
+		{"", "validation.name"},
+		{"Ivan ", "validation.name"},
+		{" Ivan", "validation.name"},
+		{"Jean  Paul", "validation.name"},
+		{"Anna--Maria", "validation.name"},
+		{"Ivan2", "validation.name"},
+		{"Ivan!", "validation.name"},
+		{"<b>Ivan</b>", "validation.name"},
+	}
+	for _, tt := range tests {
+		if got := key(Name()(tt.value)); got != tt.want {
+			t.Errorf("Name()(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestPassword(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"secret12", ""},
+		{"short1", "validation.password_length"},
+		// eight characters in sixteen bytes are long enough
+		{"пароль12", ""},
+		{"secretpassword", "validation.password_weak"},
+		{"12345678", "validation.password_weak"},
+		// bcrypt uses the first 72 bytes only
+		{"a1" + strings.Repeat("x", 70), ""},
+		{"a1" + strings.Repeat("x", 71), "validation.password_too_long"},
+		// the limit is in bytes: 37 characters of which 35 are Cyrillic are exactly 72 bytes
+		{"1" + strings.Repeat("я", 35) + "z", ""},
+		{"1" + strings.Repeat("я", 35) + "zz", "validation.password_too_long"},
+		{"1" + strings.Repeat("я", 36), "validation.password_too_long"},
+	}
+	for _, tt := range tests {
+		if got := key(Password(8)(tt.value)); got != tt.want {
+			t.Errorf("Password(8)(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	rule := Equal("secret12", "reg.password_mismatch")
+	if got := key(rule("secret12")); got != "" {
+		t.Errorf("Equal()(%q) = %q, want %q", "secret12", got, "")
+	}
+	if got := key(rule("secret13")); got != "reg.password_mismatch" {
+		t.Errorf("Equal()(%q) = %q, want %q", "secret13", got, "reg.password_mismatch")
+	}
+}
@@ -0,0 +1,88 @@
+package validation
+
+import (
+	"otus-hiload/src/i18n"
+	"sort"
+	"strings"
+)
+
+// Violation is a failed rule, Key is the message of the i18n catalog
+type Violation struct {
+	Key  string
+	Args []interface{}
+	// Plural formats the message with the plural form for the first of Args
+	Plural bool
+}
+
+// Message translates the violation
+func (v Violation) Message(l *i18n.Localizer) string {
+	if v.Plural && len(v.Args) > 0 {
+		if n, ok := v.Args[0].(int); ok {
+			return l.N(v.Key, n, v.Args[1:]...)
+		}
+	}
+	return l.T(v.Key, v.Args...)
+}
+
+// Errors are the violations by field name, one per field
+type Errors map[string]Violation
+
+func (e Errors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return "invalid fields: " + strings.Join(fields, ", ")
+}
+
+// Messages translates the violations
+func (e Errors) Messages(l *i18n.Localizer) map[string]string {
+	messages := make(map[string]string, len(e))
+	for field, v := range e {
+		messages[field] = v.Message(l)
+	}
+	return messages
+}
+
+// Rule checks the value, it returns nil if the value is valid
+type Rule func(value string) *Violation
+
+// Validator collects the first violation of every field
+type Validator struct {
+	errs Errors
+}
+
+// Check applies the rules in order and stops at the first violation
+func (v *Validator) Check(field string, value string, rules ...Rule) {
+	for _, rule := range rules {
+		if violation := rule(value); violation != nil {
+			v.Add(field, *violation)
+			return
+		}
+	}
+}
+
+// Add records a violation found outside of rules, e.g. a failed file check
+func (v *Validator) Add(field string, violation Violation) {
+	if v.errs == nil {
+		v.errs = make(Errors)
+	}
+	if _, ok := v.errs[field]; !ok {
+		v.errs[field] = violation
+	}
+}
+
+// Valid reports whether the field has no violation yet, to skip checks depending on it
+func (v *Validator) Valid(field string) bool {
+	_, ok := v.errs[field]
+	return !ok
+}
+
+// Err returns Errors if any rule failed
+func (v *Validator) Err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
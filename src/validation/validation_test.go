@@ -0,0 +1,53 @@
+package validation
+
+import (
+	"otus-hiload/src/i18n"
+	"testing"
+)
+
+func TestValidator(t *testing.T) {
+	var v Validator
+	if err := v.Err(); err != nil {
+		t.Fatalf("Err() = %v, want nil", err)
+	}
+
+	v.Check("login", "", Required(), Login())
+	v.Check("login", "Ivan", Login())
+	v.Check("name", "Иван", Required(), Name())
+	v.Add("avatar", Violation{Key: "validation.file_type"})
+
+	errs, ok := v.Err().(Errors)
+	if !ok {
+		t.Fatalf("Err() = %T, want Errors", v.Err())
+	}
+	// the first violation of the field wins, the later checks are not recorded
+	if got := errs["login"].Key; got != "validation.required" {
+		t.Errorf("errs[login] = %q, want %q", got, "validation.required")
+	}
+	if v.Valid("login") || v.Valid("avatar") || !v.Valid("name") {
+		t.Errorf("Valid() = %v %v %v, want false false true", v.Valid("login"), v.Valid("avatar"), v.Valid("name"))
+	}
+	if got, want := errs.Error(), "invalid fields: avatar, login"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestMessage(t *testing.T) {
+	tests := []struct {
+		locale    string
+		violation Violation
+		want      string
+	}{
+		{"en", Violation{Key: "validation.required"}, "this field is required"},
+		{"en", *MinRunes(1)(""), "at least 1 character"},
+		{"en", *MinRunes(3)(""), "at least 3 characters"},
+		{"ru", *MinRunes(1)(""), "не менее 1 символа"},
+		{"ru", *MinRunes(3)(""), "не менее 3 символов"},
+		{"ru", *MinRunes(5)(""), "не менее 5 символов"},
+	}
+	for _, tt := range tests {
+		if got := tt.violation.Message(i18n.New(tt.locale)); got != tt.want {
+			t.Errorf("Message(%q, %q) = %q, want %q", tt.locale, tt.violation.Key, got, tt.want)
+		}
+	}
+}
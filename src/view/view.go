@@ -0,0 +1,144 @@
+package view
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// layoutTemplate is the entry point of every page, it is defined in the layout dir
+// and includes the "title" and "content" blocks defined by the page
+const layoutTemplate = "layout"
+
+// Set holds the pages parsed once, each page is the shared layout and partials of dir/layout
+// plus the page file dir/<page>.html. Pages are parsed once per locale with the functions of that locale
+// (translation), so rendering does not clone templates per request.
+type Set struct {
+	dir     string
+	locales []string
+	funcs   func(locale string) template.FuncMap
+	mu      sync.RWMutex
+	// pages by locale and name
+	pages map[string]map[string]*template.Template
+}
+
+// Load parses all pages of dir for every locale, any invalid template fails the whole set
+func Load(dir string, locales []string, funcs func(locale string) template.FuncMap) (*Set, error) {
+	s := &Set{dir: dir, locales: locales, funcs: funcs}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload parses the templates again, the current set is kept if the new one is invalid
+func (s *Set) Reload() error {
+	pages := make(map[string]map[string]*template.Template, len(s.locales))
+	for _, locale := range s.locales {
+		localePages, err := parse(s.dir, s.funcs(locale))
+		if err != nil {
+			return err
+		}
+		pages[locale] = localePages
+	}
+	s.mu.Lock()
+	s.pages = pages
+	s.mu.Unlock()
+	return nil
+}
+
+func parse(dir string, funcs template.FuncMap) (map[string]*template.Template, error) {
+	layout, err := template.New("").Funcs(funcs).ParseGlob(filepath.Join(dir, "layout", "*.html"))
+	if err != nil {
+		return nil, fmt.Errorf("templates layout: %w", err)
+	}
+	if layout.Lookup(layoutTemplate) == nil {
+		return nil, fmt.Errorf("templates layout: %q is not defined", layoutTemplate)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+	pages := make(map[string]*template.Template, len(files))
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".html")
+		page, err := layout.Clone()
+		if err != nil {
+			return nil, err
+		}
+		_, err = page.ParseFiles(file)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", name, err)
+		}
+		pages[name] = page
+	}
+	return pages, nil
+}
+
+// Render executes the page into w, a failed page may be written partially,
+// so HTTP handlers render to a buffer first
+func (s *Set) Render(w io.Writer, locale string, name string, data interface{}) error {
+	s.mu.RLock()
+	page, ok := s.pages[locale][name]
+	s.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("template %s (%s) not found", name, locale)
+	}
+	return page.ExecuteTemplate(w, layoutTemplate, data)
+}
+
+// Watch reloads the set when a file of the templates dir changes, it is meant for development.
+// The dir is polled every interval until stop is closed.
+func (s *Set) Watch(interval time.Duration, stop <-chan struct{}) {
+	last := modTime(s.dir)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			current := modTime(s.dir)
+			if current.Equal(last) {
+				continue
+			}
+			last = current
+			if err := s.Reload(); err != nil {
+				log.Printf("templates reload failed, keeping the current ones: %s", err.Error())
+				continue
+			}
+			log.Print("templates reloaded")
+		}
+	}
+}
+
+// modTime is the latest modification time of the dir and its files, one level of subdirs deep
+func modTime(dir string) time.Time {
+	var latest time.Time
+	check := func(info os.FileInfo) {
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	for _, d := range []string{dir, filepath.Join(dir, "layout")} {
+		if info, err := os.Stat(d); err == nil {
+			check(info)
+		}
+		infos, err := ioutil.ReadDir(d)
+		if err != nil {
+			continue
+		}
+		for _, info := range infos {
+			check(info)
+		}
+	}
+	return latest
+}